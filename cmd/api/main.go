@@ -3,80 +3,57 @@ package main
 import (
 	"context"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-
-	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/app"
 	"github.com/metalpoch/local-synapse/internal/pkg/config"
-	"github.com/metalpoch/local-synapse/internal/router"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
 )
 
-var (
-	port               string
-	ollamaModel        string
-	ollamaUrl          string
-	ollamaSystemPrompt string
-	mcpClient          mcpclient.MCPClient
-)
+func main() {
+	// CONFIG_FILE is optional; environment variables override the values in the file
+	configFile := os.Getenv("CONFIG_FILE")
 
-func init() {
-	err := config.ApiEnviroment(&port, &ollamaUrl, &ollamaModel, &ollamaSystemPrompt)
+	cfg, err := config.Load(configFile)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
-
-	mcpClient, err = mcpclient.NewStdioClient("./mcp")
-
-	if err != nil {
-		log.Printf("failed to create MCP client: %v", err)
-	} else {
-		if err := mcpClient.Initialize(context.Background()); err != nil {
-			log.Printf("failed to initialize MCP client: %v", err)
-		}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
 	}
 
-}
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logging.Setup(os.Stderr, cfg.Log.Format, level)
 
-func main() {
-	e := echo.New()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	e.Use(middleware.RequestLogger())
-	e.Use(middleware.Recover())
-
-	// Register all application routes
-	router.SetupSystemRouter(e)
-	router.SetupOllamaRouter(
-		e,
-		ollamaUrl,
-		ollamaModel,
-		ollamaSystemPrompt,
-		mcpClient,
-	)
-
-	// Start the server in a background goroutine
-	go func() {
-		if err := e.Start(port); err != nil && err != http.ErrServerClosed {
-			e.Logger.Errorf("server error: %v", err)
-		}
-	}()
+	a, err := app.New(cfg, configFile)
+	if err != nil {
+		fatal(err)
+	}
+	if err := a.Start(ctx); err != nil {
+		a.Shutdown(context.Background())
+		fatal(err)
+	}
 
 	// Wait for termination signal for graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-
-	e.Logger.Info("closing the server securely...")
+	<-ctx.Done()
+	slog.Info("closing the server securely...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+	if err := a.Shutdown(shutdownCtx); err != nil {
+		fatal(err)
 	}
+}
 
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
 }
@@ -1,23 +1,106 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	promptstore "github.com/metalpoch/local-synapse/internal/infrastructure/prompt_store"
+	vectorstore "github.com/metalpoch/local-synapse/internal/infrastructure/vector_store"
+	"github.com/metalpoch/local-synapse/internal/pkg/config"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+	mcpprompts "github.com/metalpoch/local-synapse/internal/pkg/mcp_prompts"
+	mcpresources "github.com/metalpoch/local-synapse/internal/pkg/mcp_resources"
 	mcptools "github.com/metalpoch/local-synapse/internal/pkg/mcp_tools"
+	"github.com/metalpoch/local-synapse/internal/usecase/knowledge"
+	"github.com/metalpoch/local-synapse/internal/usecase/prompt"
 )
 
 func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
 	s := server.NewMCPServer(
 		"local-synapse",
 		"0.0.2",
 		server.WithLogging(),
+		server.WithPromptCapabilities(true),
+		server.WithResourceCapabilities(true, true),
 	)
 
+	// Same configuration as the API, which starts this server with its environment
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// stdout carries the protocol, so logs go to stderr like the API's
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	logging.Setup(os.Stderr, cfg.Log.Format, level)
+
 	s.AddTool(mcptools.SystemStats())
 
-	if err := server.ServeStdio(s); err != nil {
+	// The knowledge base tool is only available when embeddings are configured
+	if cfg.Models.Embed != "" && len(cfg.Ollama.URLs) > 0 {
+		store, err := vectorstore.NewSQLiteStore(cfg.Storage.KnowledgeDB)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Knowledge base disabled: %v\n", err)
+		} else {
+			defer store.Close()
+			knowledgeUC := knowledge.NewKnowledgeUsecase(ollama_infra.NewOllamaClient(cfg.Ollama.URLs[0]), store, cfg.Models.Embed, float32(cfg.Knowledge.MinScore))
+			s.AddTool(mcptools.KnowledgeSearch(knowledgeUC))
+		}
+	}
+
+	// Prompts come from the same library as the API and are re-read periodically
+	prompts, err := promptstore.NewSQLiteStore(cfg.Storage.PromptsDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Prompt library disabled: %v\n", err)
+	} else {
+		defer prompts.Close()
+		library := mcpprompts.NewPromptLibrary(s, prompt.NewPromptUsecase(prompts))
+		go library.Run(ctx, 10*time.Second)
+	}
+
+	// Resources: host metrics, files under the configured roots and log files
+	subscriptions := mcpresources.NewSubscriptions(s, 5*time.Second)
+	s.AddResource(mcpresources.SystemMetrics())
+	subscriptions.Track(mcpresources.SystemMetricsURI, func(string) (string, error) {
+		// Metrics change all the time; subscribers are notified on every poll
+		return strconv.FormatInt(time.Now().UnixNano(), 10), nil
+	})
+
+	if len(cfg.MCP.FileRoots) > 0 {
+		roots, err := mcpresources.NewFileRoots(cfg.MCP.FileRoots)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "File resources disabled: %v\n", err)
+		} else {
+			s.AddResources(roots.Resources()...)
+			s.AddResourceTemplate(roots.Template())
+			subscriptions.Track("file://", roots.Version)
+		}
+	}
+	for _, path := range cfg.MCP.LogFiles {
+		s.AddResource(mcpresources.LogFile(path))
+		subscriptions.Track(mcpresources.LogURI(path), func(string) (string, error) {
+			return mcpresources.LogVersion(path)
+		})
+	}
+	go subscriptions.Run(ctx)
+
+	stdin, stdout := subscriptions.Intercept(os.Stdin, os.Stdout)
+	if err := server.NewStdioServer(s).Listen(ctx, stdin, stdout); err != nil && ctx.Err() == nil {
 		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,311 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/metalpoch/local-synapse/internal/infrastructure/llm"
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/openai"
+	promptstore "github.com/metalpoch/local-synapse/internal/infrastructure/prompt_store"
+	vectorstore "github.com/metalpoch/local-synapse/internal/infrastructure/vector_store"
+	"github.com/metalpoch/local-synapse/internal/pkg/config"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
+	"github.com/metalpoch/local-synapse/internal/router"
+	"github.com/metalpoch/local-synapse/internal/usecase/knowledge"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+	"github.com/metalpoch/local-synapse/internal/usecase/prompt"
+)
+
+// configPollInterval is how often the configuration file is checked for changes
+const configPollInterval = 5 * time.Second
+
+// App owns every dependency of the API server and their lifecycle
+type App struct {
+	cfg     *config.Config
+	watcher *config.Watcher
+	echo    *echo.Echo
+	server  *http.Server
+
+	pool           *ollama_infra.Pool
+	generations    *ollama.GenerationRegistry
+	mcpClient      mcpclient.MCPClient
+	knowledgeStore *vectorstore.SQLiteStore
+	promptStore    *promptstore.SQLiteStore
+
+	// background stops the pool health checks and the configuration watcher;
+	// streams aborts the requests still running when draining times out
+	stopBackground context.CancelFunc
+	stopStreams    context.CancelFunc
+	listener       net.Listener
+
+	// stopTracing flushes the spans not exported yet
+	stopTracing func(context.Context) error
+}
+
+// New builds the application from a validated configuration. configFile is the file
+// cfg was loaded from, watched for changes; it may be empty.
+func New(cfg *config.Config, configFile string) (_ *App, err error) {
+	a := &App{
+		cfg:     cfg,
+		watcher: config.NewWatcher(configFile, cfg),
+	}
+	// Release whatever was built before a failure; Shutdown skips what is missing
+	defer func() {
+		if err != nil {
+			_ = a.Shutdown(context.Background())
+		}
+	}()
+
+	stopTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.OTLPEndpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: "local-synapse-api",
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.stopTracing = stopTracing
+
+	clientConfig := ollama_infra.DefaultClientConfig()
+	clientConfig.DialTimeout = cfg.Ollama.DialTimeout
+	clientConfig.ResponseHeaderTimeout = cfg.Ollama.HeaderTimeout
+	clientConfig.IdleConnTimeout = cfg.Ollama.IdleTimeout
+	clientConfig.MaxRetries = cfg.Ollama.MaxRetries
+
+	pool, err := ollama_infra.NewPool(cfg.Ollama.URLs, cfg.Ollama.LBPolicy, cfg.Ollama.HealthInterval, clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	a.pool = pool
+
+	// Ollama serves few requests in parallel; the rest wait their turn here
+	queue := ollama_infra.NewQueue(pool, ollama_infra.QueueConfig{
+		MaxConcurrent:  cfg.Queue.MaxConcurrent,
+		MaxLength:      cfg.Queue.MaxLength,
+		WaitTimeout:    cfg.Queue.WaitTimeout,
+		RolePriorities: cfg.Queue.RolePriorities,
+	})
+
+	// Models routed to the OpenAI compatible server, the rest to Ollama
+	routes := map[string]llm.Provider{}
+	if cfg.OpenAI.BaseURL != "" {
+		openaiClient := openai_infra.NewOpenAIClientWithConfig(cfg.OpenAI.BaseURL, cfg.OpenAI.APIKey, clientConfig)
+		for _, m := range cfg.OpenAI.Models {
+			routes[m] = openaiClient
+		}
+	}
+	llmProvider := llm.NewRouter(queue, routes)
+
+	var knowledgeUC *knowledge.KnowledgeUsecase
+	if cfg.Models.Embed != "" {
+		a.knowledgeStore, err = vectorstore.NewSQLiteStore(cfg.Storage.KnowledgeDB)
+		if err != nil {
+			return nil, fmt.Errorf("knowledge store: %w", err)
+		}
+		knowledgeUC = knowledge.NewKnowledgeUsecase(llmProvider, a.knowledgeStore, cfg.Models.Embed, float32(cfg.Knowledge.MinScore))
+	}
+
+	a.promptStore, err = promptstore.NewSQLiteStore(cfg.Storage.PromptsDB)
+	if err != nil {
+		return nil, fmt.Errorf("prompt store: %w", err)
+	}
+	promptUC := prompt.NewPromptUsecase(a.promptStore)
+
+	// The API keeps working without tools when the MCP server cannot be started
+	if cfg.MCP.URL != "" {
+		a.mcpClient, err = mcpclient.NewHTTPClient(cfg.MCP.URL)
+	} else {
+		a.mcpClient, err = mcpclient.NewStdioClient(cfg.MCP.Command, cfg.MCP.Args...)
+	}
+	if err != nil {
+		slog.Error("failed to create MCP client", "error", err)
+	} else if err := a.mcpClient.Initialize(context.Background()); err != nil {
+		slog.Error("failed to initialize MCP client", "error", err)
+	}
+	toolCache := ollama.NewToolCache(a.mcpClient, cfg.MCP.ToolsTTL)
+
+	contextPolicy := ollama.ContextPolicy{
+		MaxTokens:     cfg.Context.NumCtx,
+		ReserveTokens: cfg.Context.ReserveTokens,
+		Strategy:      cfg.Context.Strategy,
+		SetNumCtx:     cfg.Context.NumCtx > 0,
+	}
+	chatUC := ollama.NewStreamChatUsecase(
+		llmProvider,
+		cfg.Models.Chat,
+		cfg.Models.SystemPrompt,
+		a.mcpClient,
+		toolCache,
+		knowledgeUC,
+		promptUC,
+		contextPolicy,
+		cfg.MCP.ToolPolicies,
+		chatLimits(cfg),
+	)
+	a.generations = chatUC.Generations()
+	a.generations.SetRetention(cfg.Chat.GenerationRetention)
+	embedUC := ollama.NewEmbedUsecase(llmProvider, cfg.Models.Embed, cfg.Models.EmbedAllowed, cfg.Limits.MaxEmbedInputs)
+
+	// Prompts, allow-lists and limits follow the configuration without a restart
+	a.watcher.OnReload(func(c *config.Config) {
+		chatUC.Reconfigure(c.Models.SystemPrompt, c.MCP.ToolPolicies, chatLimits(c))
+		embedUC.Reconfigure(c.Models.EmbedAllowed, c.Limits.MaxEmbedInputs)
+		a.generations.SetRetention(c.Chat.GenerationRetention)
+		if level, err := logging.ParseLevel(c.Log.Level); err == nil {
+			logging.SetLevel(level)
+		}
+	})
+
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(tracing.Middleware())
+	e.Use(logging.Middleware())
+	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			slog.ErrorContext(c.Request().Context(), "panic recovered", "error", err, "stack", string(stack))
+			return err
+		},
+	}))
+
+	// Register all application routes
+	router.SetupSystemRouter(e)
+	router.SetupOllamaRouter(
+		e,
+		chatUC,
+		ollama.NewGenerateUsecase(queue, cfg.Models.Chat),
+		ollama.NewListModelsUsecase(llmProvider),
+		cfg.Auth.JWTSecret,
+	)
+	if cfg.Models.Embed != "" || len(cfg.Models.EmbedAllowed) > 0 {
+		router.SetupEmbeddingsRouter(e, embedUC, cfg.Auth.JWTSecret)
+	}
+	if knowledgeUC != nil {
+		router.SetupKnowledgeRouter(e, knowledgeUC, cfg.Auth.JWTSecret)
+	}
+	router.SetupPromptRouter(e, promptUC, cfg.Auth.JWTSecret)
+	router.SetupMCPRouter(e, a.mcpClient, toolCache, cfg.Auth.JWTSecret)
+	router.SetupAdminRouter(e, pool, queue, cfg.Auth.JWTSecret)
+	a.echo = e
+
+	return a, nil
+}
+
+func chatLimits(c *config.Config) ollama.ChatLimits {
+	return ollama.ChatLimits{
+		MaxPromptChars:     c.Limits.MaxPromptChars,
+		MaxHistoryMessages: c.Limits.MaxHistoryMessages,
+	}
+}
+
+// Handler returns the HTTP handler serving every route
+func (a *App) Handler() http.Handler {
+	return a.echo
+}
+
+// Start listens on the configured port and serves in the background. It returns once
+// the listener is open, so requests can be sent as soon as it succeeds.
+func (a *App) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", a.cfg.Addr())
+	if err != nil {
+		return err
+	}
+	a.listener = listener
+
+	backgroundCtx, stopBackground := context.WithCancel(context.WithoutCancel(ctx))
+	a.stopBackground = stopBackground
+	go a.pool.Run(backgroundCtx)
+	go a.watcher.Run(backgroundCtx, configPollInterval)
+
+	streamsCtx, stopStreams := context.WithCancel(context.WithoutCancel(ctx))
+	a.stopStreams = stopStreams
+	a.server = &http.Server{
+		Handler:     a.echo,
+		BaseContext: func(net.Listener) context.Context { return streamsCtx },
+	}
+
+	slog.Info("listening", "addr", listener.Addr().String())
+	go func() {
+		if err := a.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server error", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Addr is the address the server listens on, useful when the configured port is 0
+func (a *App) Addr() net.Addr {
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Addr()
+}
+
+// Shutdown stops the application in order: it stops accepting requests and waits for
+// the running ones (including chat streams) to finish, aborting them when ctx is done;
+// then it stops the background workers, the MCP server and finally the stores.
+func (a *App) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	if a.server != nil {
+		if err := a.server.Shutdown(ctx); err != nil {
+			slog.Warn("streams did not finish in time, aborting them", "error", err)
+			a.stopStreams()
+			errs = append(errs, a.server.Close())
+		}
+		a.stopStreams()
+	}
+
+	// Generations run detached from their connections; abort those nobody finished following
+	if a.generations != nil {
+		a.generations.CancelAll()
+	}
+
+	if a.stopBackground != nil {
+		a.stopBackground()
+	}
+
+	if a.mcpClient != nil {
+		if err := a.mcpClient.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing MCP client: %w", err))
+		}
+	}
+
+	errs = append(errs, a.closeStores())
+
+	// Last, so the spans of everything above are exported
+	if a.stopTracing != nil {
+		if err := a.stopTracing(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("flushing traces: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a *App) closeStores() error {
+	var errs []error
+	if a.knowledgeStore != nil {
+		if err := a.knowledgeStore.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing knowledge store: %w", err))
+		}
+	}
+	if a.promptStore != nil {
+		if err := a.promptStore.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing prompt store: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
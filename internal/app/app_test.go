@@ -0,0 +1,292 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+
+	"github.com/metalpoch/local-synapse/internal/pkg/auth"
+	"github.com/metalpoch/local-synapse/internal/pkg/config"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+)
+
+func newTestConfig(t *testing.T, ollamaURL string) *config.Config {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.Ollama.URLs = []string{ollamaURL}
+	cfg.Ollama.MaxRetries = 0
+	cfg.Models.Chat = "test-model"
+	cfg.Storage.KnowledgeDB = t.TempDir() + "/knowledge.db"
+	cfg.Storage.PromptsDB = t.TempDir() + "/prompts.db"
+	// No MCP binary in tests: the API must keep working without tools
+	cfg.MCP.Command = t.TempDir() + "/missing-mcp"
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("test configuration is invalid: %v", err)
+	}
+	return cfg
+}
+
+func TestAppServesChat(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hello", "!"))
+
+	a, err := New(newTestConfig(t, fake.URL()), "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := a.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	})
+
+	resp, err := http.Post(
+		"http://"+a.Addr().String()+"/api/v1/ollama/chat",
+		"application/json",
+		strings.NewReader(`{"prompt":"hi"}`),
+	)
+	if err != nil {
+		t.Fatalf("POST chat: %v", err)
+	}
+	defer resp.Body.Close()
+
+	events, err := testsupport.ReadSSE(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadSSE: %v", err)
+	}
+	if len(events) == 0 || events[len(events)-1].Event != "done" || !strings.Contains(events[len(events)-1].Data, "Hello!") {
+		t.Errorf("got events %+v", events)
+	}
+}
+
+func TestAppShutdownAbortsStreams(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("never ending")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn)
+
+	a, err := New(newTestConfig(t, fake.URL()), "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	resp, err := http.Get("http://" + a.Addr().String() + "/api/v1/ollama/chat?prompt=hi")
+	if err != nil {
+		t.Fatalf("GET chat: %v", err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 256)
+	if _, err := resp.Body.Read(buf); err != nil {
+		t.Fatalf("reading first event: %v", err)
+	}
+
+	// The stream never ends by itself, so draining times out and it is aborted
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	a.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("shutdown took %v", elapsed)
+	}
+}
+
+func TestNewReleasesWhatWasBuiltOnError(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	cfg := newTestConfig(t, fake.URL())
+	cfg.Tracing.Exporter = "stdout"
+	cfg.Models.Embed = "test-embed"
+	// The knowledge store and the tracer are built before the prompt store fails
+	cfg.Storage.PromptsDB = t.TempDir() + "/missing/prompts.db"
+
+	if _, err := New(cfg, ""); err == nil || !strings.Contains(err.Error(), "prompt store") {
+		t.Fatalf("got error %v, want a prompt store error", err)
+	}
+}
+
+func signToken(t *testing.T, secret, role string) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{Role: role}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func TestAdminRoutesRequireAdminRole(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	cfg := newTestConfig(t, fake.URL())
+	cfg.Auth.JWTSecret = "test-secret"
+
+	a, err := New(cfg, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { a.Shutdown(context.Background()) })
+
+	token := func(role string) string { return signToken(t, cfg.Auth.JWTSecret, role) }
+
+	for _, path := range []string{"/api/v1/admin/backends", "/api/v1/admin/queue"} {
+		for _, tc := range []struct {
+			token string
+			want  int
+		}{
+			{"", http.StatusUnauthorized},
+			{token(auth.RoleUser), http.StatusForbidden},
+			{token(auth.RoleAdmin), http.StatusOK},
+		} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if tc.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			a.Handler().ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("%s with token %q: got %d, want %d", path, tc.token, rec.Code, tc.want)
+			}
+		}
+	}
+}
+
+func TestEmbeddingsRoutesCheckTheToken(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	cfg := newTestConfig(t, fake.URL())
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.Models.Embed = "test-embed"
+
+	a, err := New(cfg, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { a.Shutdown(context.Background()) })
+
+	for _, path := range []string{"/api/v1/ollama/embeddings", "/v1/embeddings"} {
+		for _, tc := range []struct {
+			token string
+			want  int
+		}{
+			{"", http.StatusOK},
+			{"not-a-token", http.StatusUnauthorized},
+		} {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"input":"hi"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tc.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			a.Handler().ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("%s with token %q: got %d, want %d: %s", path, tc.token, rec.Code, tc.want, rec.Body)
+			}
+		}
+	}
+}
+
+func TestPromptChangesRequireAdminRole(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	cfg := newTestConfig(t, fake.URL())
+	cfg.Auth.JWTSecret = "test-secret"
+
+	a, err := New(cfg, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { a.Shutdown(context.Background()) })
+
+	send := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	admin, user := signToken(t, cfg.Auth.JWTSecret, auth.RoleAdmin), signToken(t, cfg.Auth.JWTSecret, auth.RoleUser)
+	body := `{"name":"greeting","template":"Hello"}`
+	for _, tc := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodPost, "/api/v1/prompts", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/prompts", user, http.StatusForbidden},
+		{http.MethodPost, "/api/v1/prompts", admin, http.StatusCreated},
+		{http.MethodGet, "/api/v1/prompts/greeting", "", http.StatusOK},
+		{http.MethodPut, "/api/v1/prompts/greeting", user, http.StatusForbidden},
+		{http.MethodPut, "/api/v1/prompts/greeting", admin, http.StatusOK},
+		{http.MethodDelete, "/api/v1/prompts/greeting", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/api/v1/prompts/greeting", admin, http.StatusNoContent},
+	} {
+		if got := send(tc.method, tc.path, tc.token, body); got != tc.want {
+			t.Errorf("%s %s: got %d, want %d", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestKnowledgeChangesRequireAdminRole(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	cfg := newTestConfig(t, fake.URL())
+	cfg.Auth.JWTSecret = "test-secret"
+	cfg.Models.Embed = "test-embed"
+
+	a, err := New(cfg, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { a.Shutdown(context.Background()) })
+
+	send := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	admin, user := signToken(t, cfg.Auth.JWTSecret, auth.RoleAdmin), signToken(t, cfg.Auth.JWTSecret, auth.RoleUser)
+	document := `{"title":"notes","content":"hello"}`
+	huge := `{"title":"notes","content":"` + strings.Repeat("a", 12<<20) + `"}`
+	for _, tc := range []struct {
+		method, path, token, body string
+		want                      int
+	}{
+		{http.MethodPost, "/api/v1/knowledge/documents", "", document, http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/knowledge/documents", user, document, http.StatusForbidden},
+		{http.MethodPost, "/api/v1/knowledge/documents", admin, huge, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/api/v1/knowledge/documents", admin, document, http.StatusCreated},
+		{http.MethodGet, "/api/v1/knowledge/documents", "", "", http.StatusOK},
+		{http.MethodDelete, "/api/v1/knowledge/documents/1", user, "", http.StatusForbidden},
+		{http.MethodDelete, "/api/v1/knowledge/documents/1", admin, "", http.StatusNoContent},
+	} {
+		if got := send(tc.method, tc.path, tc.token, tc.body); got != tc.want {
+			t.Errorf("%s %s: got %d, want %d", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
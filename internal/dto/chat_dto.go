@@ -0,0 +1,77 @@
+package dto
+
+import "time"
+
+// ChatRequest is a chat turn sent by an API client. History holds the previous
+// user, assistant and tool messages of the conversation, oldest first. SystemPrompt
+// names a prompt from the prompt library to use instead of the default one. Resources
+// lists MCP resource URIs whose contents are attached to the conversation. MCPPrompt
+// starts the conversation from a prompt served by the MCP server, rendered with
+// MCPPromptArgs; Prompt may then be empty. Tools restricts the MCP tools offered to
+// the model: omitted offers every tool, an empty list offers none. ExcludeTools
+// removes tools from that set.
+type ChatRequest struct {
+	Prompt        string              `json:"prompt"`
+	History       []OllamaChatMessage `json:"history,omitempty"`
+	SystemPrompt  string              `json:"system_prompt,omitempty"`
+	PromptArgs    map[string]string   `json:"prompt_args,omitempty"`
+	UserName      string              `json:"user_name,omitempty"`
+	Resources     []string            `json:"resources,omitempty"`
+	MCPPrompt     string              `json:"mcp_prompt,omitempty"`
+	MCPPromptArgs map[string]string   `json:"mcp_prompt_args,omitempty"`
+	Tools         []string            `json:"tools"`
+	ExcludeTools  []string            `json:"exclude_tools,omitempty"`
+	// ApproveTools makes every tool call wait for the client to approve or deny it
+	ApproveTools bool `json:"approve_tools,omitempty"`
+
+	// Caller is set by the API from the bearer token, never by the client
+	Caller *Caller `json:"-"`
+}
+
+// Caller identifies who makes a request: the authenticated user, if any, and the client
+// address. Anonymous callers have no user nor role.
+type Caller struct {
+	User    string
+	Role    string
+	Address string
+}
+
+// Anonymous reports whether the request carries no token
+func (c *Caller) Anonymous() bool {
+	return c == nil || (c.User == "" && c.Role == "")
+}
+
+// ToolPolicy restricts the tools offered to the model. When Allow is set only
+// those tools are offered; tools in Deny are never offered.
+type ToolPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ToolPolicies are the tool restrictions configured by the administrator, by role
+// and by user name. Both apply when a user has a role.
+type ToolPolicies struct {
+	Roles map[string]ToolPolicy `json:"roles,omitempty"`
+	Users map[string]ToolPolicy `json:"users,omitempty"`
+}
+
+type GenerationState string
+
+const (
+	GenerationRunning   GenerationState = "running"
+	GenerationCompleted GenerationState = "completed"
+	GenerationCancelled GenerationState = "cancelled"
+	GenerationFailed    GenerationState = "failed"
+)
+
+// GenerationStatus describes a running or recently finished chat generation.
+// Content is the answer streamed so far, or the partial answer when cancelled.
+type GenerationStatus struct {
+	ID         string          `json:"id"`
+	Model      string          `json:"model"`
+	User       string          `json:"user,omitempty"`
+	Status     GenerationState `json:"status"`
+	Content    string          `json:"content"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
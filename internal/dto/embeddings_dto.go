@@ -0,0 +1,63 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// EmbedInput accepts either a single string or an array of strings
+type EmbedInput []string
+
+func (in *EmbedInput) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*in = EmbedInput{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("input must be a string or an array of strings")
+	}
+	*in = many
+	return nil
+}
+
+// EmbeddingsRequest is the body of POST /api/v1/ollama/embeddings
+type EmbeddingsRequest struct {
+	Model      string                 `json:"model"`
+	Input      EmbedInput             `json:"input"`
+	Truncate   *bool                  `json:"truncate,omitempty"`
+	Dimensions int                    `json:"dimensions,omitempty"`
+	KeepAlive  string                 `json:"keep_alive,omitempty"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+	// Caller is set by the API from the bearer token, never by the client
+	Caller *Caller `json:"-"`
+}
+
+// OpenAIEmbeddingsRequest is the body of the OpenAI compatible POST /v1/embeddings
+type OpenAIEmbeddingsRequest struct {
+	Model          string     `json:"model"`
+	Input          EmbedInput `json:"input"`
+	EncodingFormat string     `json:"encoding_format,omitempty"`
+	Dimensions     int        `json:"dimensions,omitempty"`
+	User           string     `json:"user,omitempty"`
+}
+
+type OpenAIEmbeddingsResponse struct {
+	Object string                `json:"object"`
+	Data   []OpenAIEmbeddingData `json:"data"`
+	Model  string                `json:"model"`
+	Usage  OpenAIEmbeddingsUsage `json:"usage"`
+}
+
+type OpenAIEmbeddingData struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type OpenAIEmbeddingsUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
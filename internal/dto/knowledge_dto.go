@@ -0,0 +1,52 @@
+package dto
+
+import "time"
+
+const (
+	DocumentFormatText     = "text"
+	DocumentFormatMarkdown = "markdown"
+	DocumentFormatPDF      = "pdf"
+)
+
+// IngestDocumentRequest carries a document to be chunked, embedded and stored.
+// For the pdf format, Content is the text extracted from the PDF (e.g. by pdftotext)
+// with pages separated by form feeds.
+type IngestDocumentRequest struct {
+	Title   string `json:"title"`
+	Source  string `json:"source"`
+	Format  string `json:"format"`
+	Content string `json:"content"`
+}
+
+type KnowledgeDocument struct {
+	ID         int64     `json:"id"`
+	Title      string    `json:"title"`
+	Source     string    `json:"source"`
+	Format     string    `json:"format"`
+	Model      string    `json:"model"`
+	ChunkCount int       `json:"chunk_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type KnowledgeChunk struct {
+	DocumentID int64  `json:"document_id"`
+	Index      int    `json:"index"`
+	Content    string `json:"content"`
+	Page       int    `json:"page,omitempty"`
+	Section    string `json:"section,omitempty"`
+}
+
+type KnowledgePassage struct {
+	Content  string   `json:"content"`
+	Citation Citation `json:"citation"`
+}
+
+type Citation struct {
+	DocumentID int64   `json:"document_id"`
+	Title      string  `json:"title"`
+	Source     string  `json:"source"`
+	ChunkIndex int     `json:"chunk_index"`
+	Page       int     `json:"page,omitempty"`
+	Section    string  `json:"section,omitempty"`
+	Score      float32 `json:"score"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+// GetMCPPromptRequest holds the arguments used to render an MCP prompt
+type GetMCPPromptRequest struct {
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// MCPServerStatus describes a connected MCP server, as reported during initialization
+type MCPServerStatus struct {
+	Name            string      `json:"name"`
+	Version         string      `json:"version"`
+	ProtocolVersion string      `json:"protocol_version"`
+	Instructions    string      `json:"instructions,omitempty"`
+	Capabilities    interface{} `json:"capabilities"`
+	Connected       bool        `json:"connected"`
+	Error           string      `json:"error,omitempty"`
+	Tools           int         `json:"tools"`
+}
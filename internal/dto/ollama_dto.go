@@ -1,16 +1,28 @@
 package dto
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type OllamaChatMessage struct {
-	Role      string     `json:"role"`
-	Content   string     `json:"content"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Images     []string   `json:"images,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolName   string     `json:"tool_name,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Pinned messages are never dropped when the conversation is trimmed
+	Pinned bool `json:"pinned,omitempty"`
 }
 
 type ToolCall struct {
+	ID       string           `json:"id,omitempty"`
 	Function ToolCallFunction `json:"function"`
 }
 
 type ToolCallFunction struct {
+	Index     int                `json:"index"`
 	Name      string             `json:"name"`
 	Arguments ComponentArguments `json:"arguments"`
 }
@@ -18,10 +30,11 @@ type ToolCallFunction struct {
 type ComponentArguments map[string]interface{}
 
 type OllamaChatRequest struct {
-	Model    string              `json:"model"`
-	Messages []OllamaChatMessage `json:"messages"`
-	Stream   bool                `json:"stream"`
-	Tools    []Tool              `json:"tools,omitempty"`
+	Model    string                 `json:"model"`
+	Messages []OllamaChatMessage    `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Tools    []Tool                 `json:"tools,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
 }
 
 type Tool struct {
@@ -42,5 +55,105 @@ type OllamaChatResponse struct {
 		Thinking  string     `json:"thinking,omitempty"`
 		ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 	} `json:"message"`
-	Done bool `json:"done"`
+	Done               bool   `json:"done"`
+	DoneReason         string `json:"done_reason,omitempty"`
+	TotalDuration      int64  `json:"total_duration,omitempty"`
+	LoadDuration       int64  `json:"load_duration,omitempty"`
+	PromptEvalCount    int    `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int    `json:"eval_count,omitempty"`
+	EvalDuration       int64  `json:"eval_duration,omitempty"`
+}
+
+type OllamaEmbedRequest struct {
+	Model      string                 `json:"model"`
+	Input      []string               `json:"input"`
+	Truncate   *bool                  `json:"truncate,omitempty"`
+	Dimensions int                    `json:"dimensions,omitempty"`
+	KeepAlive  string                 `json:"keep_alive,omitempty"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+}
+
+type OllamaEmbedResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float32 `json:"embeddings"`
+	TotalDuration   int64       `json:"total_duration,omitempty"`
+	LoadDuration    int64       `json:"load_duration,omitempty"`
+	PromptEvalCount int         `json:"prompt_eval_count,omitempty"`
+}
+
+type OllamaGenerateRequest struct {
+	Model     string                 `json:"model"`
+	Prompt    string                 `json:"prompt"`
+	Suffix    string                 `json:"suffix,omitempty"`
+	System    string                 `json:"system,omitempty"`
+	Template  string                 `json:"template,omitempty"`
+	Context   []int                  `json:"context,omitempty"`
+	Raw       bool                   `json:"raw,omitempty"`
+	Format    json.RawMessage        `json:"format,omitempty"`
+	Images    []string               `json:"images,omitempty"`
+	Think     *bool                  `json:"think,omitempty"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	Stream    bool                   `json:"stream"`
+}
+
+type OllamaGenerateResponse struct {
+	Model              string `json:"model"`
+	Response           string `json:"response"`
+	Thinking           string `json:"thinking,omitempty"`
+	Done               bool   `json:"done"`
+	DoneReason         string `json:"done_reason,omitempty"`
+	Context            []int  `json:"context,omitempty"`
+	TotalDuration      int64  `json:"total_duration,omitempty"`
+	LoadDuration       int64  `json:"load_duration,omitempty"`
+	PromptEvalCount    int    `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int    `json:"eval_count,omitempty"`
+	EvalDuration       int64  `json:"eval_duration,omitempty"`
+}
+
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+type OllamaModel struct {
+	Name       string    `json:"name"`
+	Model      string    `json:"model"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+type OllamaPsResponse struct {
+	Models []OllamaRunningModel `json:"models"`
+}
+
+type OllamaRunningModel struct {
+	Name      string    `json:"name"`
+	Model     string    `json:"model"`
+	Size      int64     `json:"size"`
+	SizeVRAM  int64     `json:"size_vram"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OllamaBackendStatus reports the state of one Ollama host in the backend pool
+type OllamaBackendStatus struct {
+	URL           string    `json:"url"`
+	Healthy       bool      `json:"healthy"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastCheck     time.Time `json:"last_check"`
+	Models        []string  `json:"models"`
+	RunningModels []string  `json:"running_models"`
+	InFlight      int64     `json:"in_flight"`
+	Requests      int64     `json:"requests"`
+	Failures      int64     `json:"failures"`
+}
+
+// QueueStats reports the load of the queue in front of Ollama
+type QueueStats struct {
+	Running       int `json:"running"`
+	Waiting       int `json:"waiting"`
+	MaxConcurrent int `json:"max_concurrent"`
+	MaxLength     int `json:"max_length"`
 }
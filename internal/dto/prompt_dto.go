@@ -0,0 +1,43 @@
+package dto
+
+import "time"
+
+// PromptTemplate is a named system prompt from the prompt library. Template is a Go
+// text/template rendered with PromptVariables.
+type PromptTemplate struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Template    string           `json:"template"`
+	Arguments   []PromptArgument `json:"arguments"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// PromptArgument declares a custom variable available to the template as {{.Args.name}}
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptVariables are the values a prompt template can reference
+type PromptVariables struct {
+	Date     string
+	Time     string
+	UserName string
+	HostName string
+	Model    string
+	Tools    []string
+	Args     map[string]string
+}
+
+type RenderPromptRequest struct {
+	UserName string            `json:"user_name,omitempty"`
+	Tools    []string          `json:"tools,omitempty"`
+	Args     map[string]string `json:"args,omitempty"`
+}
+
+type RenderPromptResponse struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
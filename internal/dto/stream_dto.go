@@ -0,0 +1,82 @@
+package dto
+
+type StreamEventType string
+
+const (
+	StreamEventStart      StreamEventType = "start"
+	StreamEventQueued     StreamEventType = "queued"
+	StreamEventToken      StreamEventType = "token"
+	StreamEventThinking   StreamEventType = "thinking"
+	StreamEventCitations  StreamEventType = "citations"
+	StreamEventToolCall   StreamEventType = "tool_call"
+	StreamEventToolResult StreamEventType = "tool_result"
+	StreamEventError      StreamEventType = "error"
+	StreamEventUsage      StreamEventType = "usage"
+	StreamEventDone       StreamEventType = "done"
+	StreamEventCancelled  StreamEventType = "cancelled"
+)
+
+// StreamEvent is a single typed event emitted while a chat is being generated
+type StreamEvent struct {
+	ID   int64           `json:"id"`
+	Type StreamEventType `json:"type"`
+	Data interface{}     `json:"data"`
+}
+
+// StartEventData opens every chat stream; GenerationID is used to cancel or look up the generation
+type StartEventData struct {
+	GenerationID string `json:"generation_id"`
+	Model        string `json:"model"`
+}
+
+type TokenEventData struct {
+	Content string `json:"content"`
+}
+
+type CitationsEventData struct {
+	Citations []Citation `json:"citations"`
+}
+
+type ToolCallEventData struct {
+	ID        string             `json:"id"`
+	Index     int                `json:"index"`
+	Name      string             `json:"name"`
+	Arguments ComponentArguments `json:"arguments"`
+	// AwaitingApproval is set when the call runs only after the client approves it
+	AwaitingApproval bool `json:"awaiting_approval,omitempty"`
+}
+
+type ToolResultEventData struct {
+	ID      string `json:"id"`
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	IsError bool   `json:"is_error"`
+}
+
+type ErrorEventData struct {
+	Message string `json:"message"`
+	// Code is the HTTP status the error would have outside a stream, like 503 when the
+	// model server is saturated
+	Code int `json:"code,omitempty"`
+}
+
+type UsageEventData struct {
+	PromptTokens     int   `json:"prompt_tokens"`
+	CompletionTokens int   `json:"completion_tokens"`
+	TotalTokens      int   `json:"total_tokens"`
+	TotalDuration    int64 `json:"total_duration"`
+	LoadDuration     int64 `json:"load_duration"`
+	EvalDuration     int64 `json:"eval_duration"`
+}
+
+type DoneEventData struct {
+	Content    string `json:"content"`
+	DoneReason string `json:"done_reason,omitempty"`
+	Context    []int  `json:"context,omitempty"`
+}
+
+// CancelledEventData ends a stream cancelled explicitly, with the answer generated so far
+type CancelledEventData struct {
+	Content string `json:"content"`
+}
@@ -0,0 +1,45 @@
+package dto
+
+// Messages of the WebSocket chat protocol. The server also forwards every stream event
+// of a generation, with the event type as the message type.
+const (
+	// Sent by the client
+	WSMessageChat    = "message"
+	WSMessageApprove = "approve"
+	WSMessageCancel  = "cancel"
+	WSMessageTyping  = "typing"
+	WSMessagePong    = "pong"
+
+	// Sent by the server
+	WSMessagePing   = "ping"
+	WSMessageQueued = "queued"
+	WSMessageError  = "error"
+)
+
+// ToolApprovalRequest approves or denies a tool call of a chat started with approve_tools
+type ToolApprovalRequest struct {
+	ToolCallID string `json:"tool_call_id"`
+	Approved   bool   `json:"approved"`
+}
+
+// WSClientMessage is a message from a WebSocket chat client. A chat message takes the
+// same fields as POST /api/v1/ollama/chat; an approval, those of ToolApprovalRequest.
+type WSClientMessage struct {
+	Type string `json:"type"`
+	ChatRequest
+	ToolApprovalRequest
+}
+
+// WSServerMessage is a message to a WebSocket chat client. Stream events carry the
+// generation they belong to and their ID within it.
+type WSServerMessage struct {
+	Type         string      `json:"type"`
+	GenerationID string      `json:"generation_id,omitempty"`
+	ID           int64       `json:"id,omitempty"`
+	Data         interface{} `json:"data,omitempty"`
+}
+
+// QueuedEventData tells a WebSocket client its message waits for the running generation
+type QueuedEventData struct {
+	Position int `json:"position"`
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+)
+
+type adminHandler struct {
+	ollamaPool  *ollama_infra.Pool
+	ollamaQueue *ollama_infra.Queue
+}
+
+func NewAdminHandler(ollamaPool *ollama_infra.Pool, ollamaQueue *ollama_infra.Queue) *adminHandler {
+	return &adminHandler{ollamaPool, ollamaQueue}
+}
+
+// Backends reports the health, models and load of every Ollama backend
+func (h *adminHandler) Backends(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.ollamaPool.Status())
+}
+
+// Queue reports how many requests are running on Ollama and how many are waiting
+func (h *adminHandler) Queue(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.ollamaQueue.Stats())
+}
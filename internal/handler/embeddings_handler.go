@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+)
+
+type embeddingsHandler struct {
+	embedUC *ollama.EmbedUsecase
+}
+
+func NewEmbeddingsHandler(embedUC *ollama.EmbedUsecase) *embeddingsHandler {
+	return &embeddingsHandler{embedUC}
+}
+
+// Embed returns embeddings in Ollama's /api/embed response format
+func (h *embeddingsHandler) Embed(c echo.Context) error {
+	var req dto.EmbeddingsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+	req.Caller, _ = callerFromContext(c)
+
+	resp, err := h.embedUC.Execute(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(embedErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// OpenAIEmbed returns embeddings in the OpenAI /v1/embeddings response format
+func (h *embeddingsHandler) OpenAIEmbed(c echo.Context) error {
+	var req dto.OpenAIEmbeddingsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, openAIError("invalid request body", "invalid_request_error"))
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" {
+		return c.JSON(http.StatusBadRequest, openAIError("only the 'float' encoding_format is supported", "invalid_request_error"))
+	}
+
+	caller, _ := callerFromContext(c)
+	resp, err := h.embedUC.Execute(c.Request().Context(), dto.EmbeddingsRequest{
+		Model:      req.Model,
+		Input:      req.Input,
+		Dimensions: req.Dimensions,
+		Caller:     caller,
+	})
+	if err != nil {
+		status := embedErrorStatus(err)
+		errType := "api_error"
+		if status < http.StatusInternalServerError {
+			errType = "invalid_request_error"
+		}
+		return c.JSON(status, openAIError(err.Error(), errType))
+	}
+
+	out := dto.OpenAIEmbeddingsResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingData, 0, len(resp.Embeddings)),
+		Model:  resp.Model,
+		Usage: dto.OpenAIEmbeddingsUsage{
+			PromptTokens: resp.PromptEvalCount,
+			TotalTokens:  resp.PromptEvalCount,
+		},
+	}
+	for i, embedding := range resp.Embeddings {
+		out.Data = append(out.Data, dto.OpenAIEmbeddingData{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		})
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func embedErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ollama.ErrModelNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, ollama.ErrInvalidInput):
+		return http.StatusBadRequest
+	default:
+		return upstreamErrorStatus(err)
+	}
+}
+
+func openAIError(message, errType string) echo.Map {
+	return echo.Map{"error": echo.Map{"message": message, "type": errType}}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/dto"
+	vectorstore "github.com/metalpoch/local-synapse/internal/infrastructure/vector_store"
+	"github.com/metalpoch/local-synapse/internal/usecase/knowledge"
+)
+
+// maxUploadSize bounds uploaded documents to 10 MiB
+const maxUploadSize = 10 << 20
+
+type knowledgeHandler struct {
+	knowledgeUC *knowledge.KnowledgeUsecase
+}
+
+func NewKnowledgeHandler(knowledgeUC *knowledge.KnowledgeUsecase) *knowledgeHandler {
+	return &knowledgeHandler{knowledgeUC}
+}
+
+// Ingest accepts either a JSON document or a multipart upload in the "file" field
+func (h *knowledgeHandler) Ingest(c echo.Context) error {
+	var req dto.IngestDocumentRequest
+
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "form field 'file' is required"})
+		}
+		if file.Size > maxUploadSize {
+			return c.JSON(http.StatusRequestEntityTooLarge, echo.Map{"error": "file is too large"})
+		}
+
+		src, err := file.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		defer src.Close()
+
+		content, err := io.ReadAll(io.LimitReader(src, maxUploadSize))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		req = dto.IngestDocumentRequest{
+			Title:   c.FormValue("title"),
+			Source:  file.Filename,
+			Format:  c.FormValue("format"),
+			Content: string(content),
+		}
+		if req.Format == "" {
+			req.Format = formatFromFilename(file.Filename)
+		}
+	} else if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+
+	doc, err := h.knowledgeUC.Ingest(c.Request().Context(), req)
+	if err != nil {
+		if errors.Is(err, knowledge.ErrInvalidDocument) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		return c.JSON(upstreamErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, doc)
+}
+
+func (h *knowledgeHandler) List(c echo.Context) error {
+	docs, err := h.knowledgeUC.ListDocuments(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, docs)
+}
+
+func (h *knowledgeHandler) Delete(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid document id"})
+	}
+
+	if err := h.knowledgeUC.DeleteDocument(c.Request().Context(), id); err != nil {
+		if errors.Is(err, vectorstore.ErrDocumentNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *knowledgeHandler) Search(c echo.Context) error {
+	query := c.QueryParam("q")
+	if query == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "query parameter 'q' is required"})
+	}
+
+	k, _ := strconv.Atoi(c.QueryParam("k"))
+
+	passages, err := h.knowledgeUC.Search(c.Request().Context(), query, k)
+	if err != nil {
+		return c.JSON(upstreamErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, passages)
+}
+
+func formatFromFilename(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown":
+		return dto.DocumentFormatMarkdown
+	case ".pdf":
+		return dto.DocumentFormatPDF
+	default:
+		return dto.DocumentFormatText
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/dto"
+	mcp_usecase "github.com/metalpoch/local-synapse/internal/usecase/mcp"
+)
+
+type mcpHandler struct {
+	mcpUC *mcp_usecase.MCPUsecase
+}
+
+func NewMCPHandler(mcpUC *mcp_usecase.MCPUsecase) *mcpHandler {
+	return &mcpHandler{mcpUC}
+}
+
+func (h *mcpHandler) ListPrompts(c echo.Context) error {
+	prompts, err := h.mcpUC.ListPrompts(c.Request().Context())
+	if err != nil {
+		return c.JSON(mcpErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"prompts": prompts})
+}
+
+// GetPrompt renders an MCP prompt with the arguments in the body
+func (h *mcpHandler) GetPrompt(c echo.Context) error {
+	var req dto.GetMCPPromptRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+
+	result, err := h.mcpUC.GetPrompt(c.Request().Context(), c.Param("name"), req.Arguments)
+	if err != nil {
+		return c.JSON(mcpErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// Resources lists the resources and resource templates that can be attached to a chat
+func (h *mcpHandler) Resources(c echo.Context) error {
+	resources, templates, err := h.mcpUC.ListResources(c.Request().Context())
+	if err != nil {
+		return c.JSON(mcpErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"resources": resources, "templates": templates})
+}
+
+// Servers reports the MCP servers the API is connected to
+func (h *mcpHandler) Servers(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"servers": h.mcpUC.Servers(c.Request().Context())})
+}
+
+// Tools lists the tools with their input schemas
+func (h *mcpHandler) Tools(c echo.Context) error {
+	tools, err := h.mcpUC.ListTools(c.Request().Context())
+	if err != nil {
+		return c.JSON(mcpErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"tools": tools})
+}
+
+// RefreshTools reloads the cached tool list used by the chat endpoints
+func (h *mcpHandler) RefreshTools(c echo.Context) error {
+	count, err := h.mcpUC.RefreshTools(c.Request().Context())
+	if err != nil {
+		return c.JSON(mcpErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"tools": count})
+}
+
+// CallTool invokes a tool with the JSON object in the body as arguments
+func (h *mcpHandler) CallTool(c echo.Context) error {
+	args := map[string]any{}
+	if c.Request().ContentLength != 0 {
+		if err := json.NewDecoder(c.Request().Body).Decode(&args); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "body must be a JSON object with the tool arguments"})
+		}
+	}
+
+	result, err := h.mcpUC.CallTool(c.Request().Context(), c.Param("name"), args)
+	if err != nil {
+		return c.JSON(mcpErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func mcpErrorStatus(err error) int {
+	if errors.Is(err, mcp_usecase.ErrMCPUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, mcp_usecase.ErrToolNotFound) {
+		return http.StatusNotFound
+	}
+	// Anything else was reported by the MCP server
+	return http.StatusBadGateway
+}
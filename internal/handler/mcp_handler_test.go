@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+	mcp_usecase "github.com/metalpoch/local-synapse/internal/usecase/mcp"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+)
+
+func TestListResources(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		client func() mcpclient.MCPClient
+		want   int
+		body   string
+	}{
+		{"connected", func() mcpclient.MCPClient { return testsupport.NewMCPClient(t, testsupport.NewMCPServer()) }, http.StatusOK, `"uri":"note://welcome"`},
+		{"without MCP", func() mcpclient.MCPClient { return nil }, http.StatusServiceUnavailable, `"error"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := tc.client()
+			h := NewMCPHandler(mcp_usecase.NewMCPUsecase(client, ollama.NewToolCache(client, 0)))
+			e := echo.New()
+			e.GET("/api/v1/mcp/resources", h.Resources)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/mcp/resources", nil))
+			if rec.Code != tc.want || !strings.Contains(rec.Body.String(), tc.body) {
+				t.Errorf("got %d: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
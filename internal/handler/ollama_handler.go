@@ -2,20 +2,43 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/pkg/auth"
 	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
 )
 
 type ollamaHandler struct {
-	chatUC *ollama.StreamChatUsecase
+	chatUC     *ollama.StreamChatUsecase
+	generateUC *ollama.GenerateUsecase
+	modelsUC   *ollama.ListModelsUsecase
 }
 
-func NewOllamaHandler(chatUC *ollama.StreamChatUsecase) *ollamaHandler {
-	return &ollamaHandler{chatUC}
+func NewOllamaHandler(
+	chatUC *ollama.StreamChatUsecase,
+	generateUC *ollama.GenerateUsecase,
+	modelsUC *ollama.ListModelsUsecase,
+) *ollamaHandler {
+	return &ollamaHandler{chatUC, generateUC, modelsUC}
+}
+
+// Models lists the models available across all providers
+func (h *ollamaHandler) Models(c echo.Context) error {
+	models, err := h.modelsUC.Execute(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"models": models})
 }
 
 func (h *ollamaHandler) Stream(c echo.Context) error {
@@ -24,12 +47,302 @@ func (h *ollamaHandler) Stream(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Query parameter 'prompt' is required")
 	}
 
-	format := c.QueryParam("format")
-	isPlain := format == "plain"
+	return h.streamChat(c, dto.ChatRequest{
+		Prompt:       userPrompt,
+		SystemPrompt: c.QueryParam("system_prompt"),
+		UserName:     c.QueryParam("user_name"),
+		Resources:    c.QueryParams()["resource"],
+		Tools:        toolsFromQuery(c),
+		ExcludeTools: splitList(c.QueryParam("exclude_tools")),
+		ApproveTools: c.QueryParam("approve_tools") == "true",
+	})
+}
+
+// StreamConversation is the multi-turn variant of Stream: the prompt and the previous
+// messages of the conversation are sent as a JSON body
+func (h *ollamaHandler) StreamConversation(c echo.Context) error {
+	var req dto.ChatRequest
+	if err := c.Bind(&req); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Prompt == "" && req.MCPPrompt == "" {
+		return c.String(http.StatusBadRequest, "Field 'prompt' or 'mcp_prompt' is required")
+	}
+	if !validHistory(req.History) {
+		return c.String(http.StatusBadRequest, "History may only contain user, assistant and tool messages")
+	}
+
+	return h.streamChat(c, req)
+}
+
+// validHistory reports whether the history sent by a client only has the roles it may send
+func validHistory(history []dto.OllamaChatMessage) bool {
+	for _, msg := range history {
+		switch msg.Role {
+		case "user", "assistant", "tool":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (h *ollamaHandler) streamChat(c echo.Context, req dto.ChatRequest) error {
+	caller, admin := callerFromContext(c)
+
+	// A browser reconnecting after a dropped connection resumes the generation it was
+	// following instead of starting the prompt again
+	if id, after, ok := parseEventID(c.Request().Header.Get("Last-Event-ID")); ok {
+		return h.followGeneration(c, id, after, caller, admin)
+	}
+
+	// Resolve the system prompt before the stream starts so a bad name is a plain 4xx
+	req.Caller = caller
+	if err := h.chatUC.Validate(c.Request().Context(), req); err != nil {
+		if errors.Is(err, ollama.ErrPromptLibraryDisabled) || errors.Is(err, ollama.ErrMCPUnavailable) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if errors.Is(err, ollama.ErrRequestTooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, echo.Map{"error": err.Error()})
+		}
+		return c.JSON(promptErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	// The generation outlives this connection so a client can reconnect and resume it
+	id := h.chatUC.Start(c.Request().Context(), req)
+	return h.followGeneration(c, id, 0, caller, admin)
+}
+
+// ResumeChat replays the events of a generation after the one given in the Last-Event-ID
+// header (or the last_event_id query parameter) and keeps following it until it ends
+func (h *ollamaHandler) ResumeChat(c echo.Context) error {
+	id := c.Param("id")
+
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("last_event_id")
+	}
+
+	var after int64
+	if lastEventID != "" {
+		eventGeneration, seq, ok := parseEventID(lastEventID)
+		if !ok {
+			// Plain sequence numbers are accepted as well
+			eventGeneration = id
+			n, err := strconv.ParseInt(lastEventID, 10, 64)
+			if err != nil || n < 0 {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid last event ID"})
+			}
+			seq = n
+		}
+		if eventGeneration != id {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "last event ID belongs to another generation"})
+		}
+		after = seq
+	}
+
+	caller, admin := callerFromContext(c)
+	return h.followGeneration(c, id, after, caller, admin)
+}
+
+// followGeneration streams the events of a generation after the given sequence number
+func (h *ollamaHandler) followGeneration(c echo.Context, id string, after int64, caller *dto.Caller, admin bool) error {
+	sub, err := h.chatUC.Generations().Subscribe(id, caller, admin)
+	if err != nil {
+		return c.JSON(generationErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	stream := newEventStream(c, id)
+
+	ctx := c.Request().Context()
+	if err := sub.Stream(ctx, after, stream.write); err != nil {
+		if ctx.Err() == nil {
+			// Headers are already sent; the generation keeps running and can be resumed
+			slog.ErrorContext(ctx, "chat stream to client failed", "generation_id", id, "error", err)
+		}
+		return nil
+	}
+
+	return stream.end(sub.Err())
+}
+
+// parseEventID splits the SSE event ID of a chat stream, "<generation>:<sequence>"
+func parseEventID(value string) (string, int64, bool) {
+	id, seq, ok := strings.Cut(value, ":")
+	if !ok || id == "" {
+		return "", 0, false
+	}
+	n, err := strconv.ParseInt(seq, 10, 64)
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	return id, n, true
+}
+
+// CancelChat aborts a running generation, identified by the ID sent in its start event
+func (h *ollamaHandler) CancelChat(c echo.Context) error {
+	caller, admin := callerFromContext(c)
+	if err := h.chatUC.Generations().Cancel(c.Param("id"), caller, admin); err != nil {
+		return c.JSON(generationErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// ApproveTool approves or denies a tool call of a generation started with approve_tools
+func (h *ollamaHandler) ApproveTool(c echo.Context) error {
+	var req dto.ToolApprovalRequest
+	if err := c.Bind(&req); err != nil || req.ToolCallID == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "field 'tool_call_id' is required"})
+	}
+
+	caller, admin := callerFromContext(c)
+	if err := h.chatUC.Generations().Approve(c.Param("id"), req.ToolCallID, req.Approved, caller, admin); err != nil {
+		return c.JSON(generationErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ChatStatus reports whether a generation is still running and the answer produced so far
+func (h *ollamaHandler) ChatStatus(c echo.Context) error {
+	caller, admin := callerFromContext(c)
+	status, err := h.chatUC.Generations().Status(c.Param("id"), caller, admin)
+	if err != nil {
+		return c.JSON(generationErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+func callerFromContext(c echo.Context) (*dto.Caller, bool) {
+	claims := auth.ClaimsFromContext(c)
+	if claims == nil {
+		return &dto.Caller{Address: c.RealIP()}, false
+	}
+	return &dto.Caller{User: claims.Subject, Role: claims.Role, Address: c.RealIP()}, claims.Role == auth.RoleAdmin
+}
+
+func generationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ollama.ErrGenerationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ollama.ErrGenerationForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ollama.ErrGenerationFinished), errors.Is(err, ollama.ErrApprovalNotPending):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// upstreamErrorStatus maps an error from the model server: 503 when the request could
+// not get its turn in the queue, 502 otherwise
+func upstreamErrorStatus(err error) int {
+	if errors.Is(err, ollama_infra.ErrQueueFull) || errors.Is(err, ollama_infra.ErrQueueTimeout) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+// toolsFromQuery reads the "tools" query parameter: absent offers every tool,
+// present but empty (or "none") offers none
+func toolsFromQuery(c echo.Context) []string {
+	if _, ok := c.QueryParams()["tools"]; !ok {
+		return nil
+	}
+	value := c.QueryParam("tools")
+	if value == "none" {
+		return []string{}
+	}
+	tools := splitList(value)
+	if tools == nil {
+		return []string{}
+	}
+	return tools
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Generate streams a raw completion from /api/generate using the same output modes as Stream
+func (h *ollamaHandler) Generate(c echo.Context) error {
+	var req dto.OllamaGenerateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Prompt == "" && req.Suffix == "" {
+		return c.String(http.StatusBadRequest, "Field 'prompt' is required")
+	}
+
+	stream := newEventStream(c, "")
+
+	err := h.generateUC.Execute(c.Request().Context(), req, stream.write)
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "generate stream failed", "error", err)
+	}
+
+	// Once the stream is open the error has been reported in it
+	return stream.end(err)
+}
+
+// eventStream writes stream events as SSE, or as plain text when the query has
+// format=plain. SSE event IDs are prefixed with generationID, when given, so a reconnect
+// can find the generation. The headers are held back while the request waits for the
+// model server queue, so a request the queue refuses or gives up on gets a real 503.
+type eventStream struct {
+	c            echo.Context
+	generationID string
+	plain        bool
+	open         bool
+	held         []dto.StreamEvent
+}
+
+func newEventStream(c echo.Context, generationID string) *eventStream {
+	return &eventStream{
+		c:            c,
+		generationID: generationID,
+		plain:        c.QueryParam("format") == "plain",
+	}
+}
 
-	// Set up streaming response headers
-	res := c.Response()
-	if isPlain {
+// write sends an event, opening the stream once the request is past the queue
+func (s *eventStream) write(event dto.StreamEvent) error {
+	if s.open {
+		return s.send(event)
+	}
+	s.held = append(s.held, event)
+	switch event.Type {
+	case dto.StreamEventStart, dto.StreamEventQueued, dto.StreamEventError:
+		// An error may still turn into a plain response when the stream ends
+		return nil
+	}
+	return s.flush()
+}
+
+// end completes a stream that never opened: err, the error the request failed with, is
+// answered with its status when the queue refused it, otherwise the held events are sent
+func (s *eventStream) end(err error) error {
+	if s.open {
+		return nil
+	}
+	if err != nil && upstreamErrorStatus(err) == http.StatusServiceUnavailable {
+		return s.c.JSON(http.StatusServiceUnavailable, echo.Map{"error": err.Error()})
+	}
+	return s.flush()
+}
+
+// flush writes the streaming response headers and the events held so far
+func (s *eventStream) flush() error {
+	res := s.c.Response()
+	if s.plain {
 		res.Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
 	} else {
 		res.Header().Set(echo.HeaderContentType, "text/event-stream")
@@ -39,39 +352,73 @@ func (h *ollamaHandler) Stream(c echo.Context) error {
 	res.Header().Set("X-Content-Type-Options", "nosniff")
 	res.Header().Set("X-Accel-Buffering", "no")
 	res.WriteHeader(http.StatusOK)
+	s.open = true
 
-	ctx := c.Request().Context()
-
-	// Process each response chunk from the LLM
-	onChunk := func(chunk dto.OllamaChatResponse) error {
-		if isPlain {
-			if chunk.Message.Thinking != "" {
-				if _, err := fmt.Fprintf(res.Writer, "[Thinking: %s]\n", chunk.Message.Thinking); err != nil {
-					return err
-				}
-			}
-			if chunk.Message.Content != "" {
-				if _, err := fmt.Fprint(res.Writer, chunk.Message.Content); err != nil {
-					return err
-				}
-			}
-		} else {
-			// Skip chunks without relevant updates for SSE
-			if chunk.Message.Content == "" && chunk.Message.Thinking == "" && len(chunk.Message.ToolCalls) == 0 {
-				return nil
-			}
+	held := s.held
+	s.held = nil
+	for _, event := range held {
+		if err := s.send(event); err != nil {
+			return err
+		}
+	}
+	res.Flush()
+	return nil
+}
 
-			jsonData, err := json.Marshal(chunk)
-			if err != nil {
-				return err
-			}
-			if _, err := fmt.Fprintf(res.Writer, "data: %s\n\n", jsonData); err != nil {
-				return err
-			}
+func (s *eventStream) send(event dto.StreamEvent) error {
+	res := s.c.Response()
+	var err error
+	if s.plain {
+		err = writePlainEvent(res.Writer, event)
+	} else {
+		id := strconv.FormatInt(event.ID, 10)
+		if s.generationID != "" {
+			id = s.generationID + ":" + id
 		}
-		res.Flush()
-		return nil
+		err = writeSSEEvent(res.Writer, id, event)
 	}
+	if err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
 
-	return h.chatUC.Execute(ctx, userPrompt, onChunk)
+// writeSSEEvent writes an event using the text/event-stream framing
+func writeSSEEvent(w io.Writer, id string, event dto.StreamEvent) error {
+	jsonData, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event.Type, jsonData)
+	return err
+}
+
+// writePlainEvent renders an event as human readable text
+func writePlainEvent(w io.Writer, event dto.StreamEvent) error {
+	var err error
+	switch data := event.Data.(type) {
+	case dto.TokenEventData:
+		if event.Type == dto.StreamEventThinking {
+			_, err = fmt.Fprintf(w, "[Thinking: %s]\n", data.Content)
+		} else {
+			_, err = fmt.Fprint(w, data.Content)
+		}
+	case dto.ToolCallEventData:
+		args, _ := json.Marshal(data.Arguments)
+		_, err = fmt.Fprintf(w, "\n[Tool call: %s %s]\n", data.Name, args)
+	case dto.ToolResultEventData:
+		status := "result"
+		if data.IsError {
+			status = "error"
+		}
+		_, err = fmt.Fprintf(w, "[Tool %s: %s] %s\n", status, data.Name, strings.TrimSpace(data.Content))
+	case dto.ErrorEventData:
+		_, err = fmt.Fprintf(w, "\n[Error: %s]\n", data.Message)
+	case dto.CancelledEventData:
+		_, err = fmt.Fprint(w, "\n[Cancelled]\n")
+	case dto.QueuedEventData:
+		_, err = fmt.Fprintf(w, "[Queued: position %d]\n", data.Position)
+	}
+	return err
 }
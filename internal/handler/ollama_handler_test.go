@@ -0,0 +1,493 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/llm"
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+)
+
+func newTestServer(t *testing.T, fake *testsupport.FakeOllama, client mcpclient.MCPClient, limits ollama.ChatLimits) *echo.Echo {
+	t.Helper()
+
+	config := ollama_infra.DefaultClientConfig()
+	config.MaxRetries = 0
+	return newTestServerWith(ollama_infra.NewOllamaClientWithConfig(fake.URL(), config), client, limits)
+}
+
+// testProvider is what the chat and generate use cases run on, a client or a queue
+type testProvider interface {
+	llm.Provider
+	ollama_infra.Client
+}
+
+// newTestServerWith serves the Ollama routes on top of provider
+func newTestServerWith(provider testProvider, client mcpclient.MCPClient, limits ollama.ChatLimits) *echo.Echo {
+	h := NewOllamaHandler(
+		ollama.NewStreamChatUsecase(
+			provider, "test-model", "You are a test.", client, ollama.NewToolCache(client, 0),
+			nil, nil, ollama.ContextPolicy{}, dto.ToolPolicies{}, limits,
+		),
+		ollama.NewGenerateUsecase(provider, "test-model"),
+		ollama.NewListModelsUsecase(provider),
+	)
+
+	e := echo.New()
+	e.GET("/api/v1/ollama/chat", h.Stream)
+	e.POST("/api/v1/ollama/chat", h.StreamConversation)
+	e.GET("/api/v1/ollama/chat/:id", h.ChatStatus)
+	e.GET("/api/v1/ollama/chat/:id/events", h.ResumeChat)
+	e.DELETE("/api/v1/ollama/chat/:id", h.CancelChat)
+	e.POST("/api/v1/ollama/chat/:id/approvals", h.ApproveTool)
+	e.GET("/api/v1/ollama/ws", h.WebSocket)
+	e.GET("/api/v1/ollama/models", h.Models)
+	e.POST("/api/v1/ollama/generate", h.Generate)
+	return e
+}
+
+func postChat(e *echo.Echo, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ollama/chat", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStreamConversationSSEFraming(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hi", " there"))
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{})
+
+	rec := postChat(e, `{"prompt":"hello","history":[{"role":"user","content":"a"},{"role":"assistant","content":"b"}]}`)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "text/event-stream" {
+		t.Errorf("got content type %q", ct)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "\n\n") {
+		t.Error("the stream does not end with a complete event")
+	}
+
+	events, err := testsupport.ReadSSE(rec.Body)
+	if err != nil {
+		t.Fatalf("ReadSSE: %v", err)
+	}
+	want := []string{"start", "token", "token", "usage", "done"}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events: %+v", len(events), events)
+	}
+	var start dto.StartEventData
+	if err := json.Unmarshal([]byte(events[0].Data), &start); err != nil || start.GenerationID == "" {
+		t.Fatalf("got start data %q", events[0].Data)
+	}
+	for i, e := range events {
+		if e.Event != want[i] {
+			t.Errorf("event %d is %q, want %q", i, e.Event, want[i])
+		}
+		if e.ID != start.GenerationID+":"+strconv.Itoa(i+1) {
+			t.Errorf("event %d has id %q", i, e.ID)
+		}
+	}
+
+	var token dto.TokenEventData
+	if err := json.Unmarshal([]byte(events[1].Data), &token); err != nil || token.Content != "Hi" {
+		t.Errorf("got token data %q", events[1].Data)
+	}
+	var done dto.DoneEventData
+	if err := json.Unmarshal([]byte(events[4].Data), &done); err != nil || done.Content != "Hi there" {
+		t.Errorf("got done data %q", events[4].Data)
+	}
+
+	if messages := fake.ChatRequests()[0].Messages; len(messages) != 4 {
+		t.Errorf("history was not forwarded: %+v", messages)
+	}
+}
+
+func TestStreamPlainFormat(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hi", " there"))
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ollama/chat?prompt=hello&format=plain", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if ct := rec.Header().Get(echo.HeaderContentType); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("got content type %q", ct)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "Hi there") {
+		t.Errorf("got body %q", rec.Body.String())
+	}
+}
+
+func TestStreamConversationToolLoop(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(
+		testsupport.ToolCallTurn(testsupport.ToolCall("add", map[string]any{"a": 2, "b": 2})),
+		testsupport.TextTurn("4"),
+	)
+	client := testsupport.NewMCPClient(t, testsupport.NewMCPServer())
+	e := newTestServer(t, fake, client, ollama.ChatLimits{})
+
+	rec := postChat(e, `{"prompt":"2+2?"}`)
+	events, err := testsupport.ReadSSE(rec.Body)
+	if err != nil {
+		t.Fatalf("ReadSSE: %v", err)
+	}
+
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Event)
+	}
+	if got := strings.Join(types, ","); got != "start,tool_call,tool_result,token,usage,done" {
+		t.Fatalf("got events %s", got)
+	}
+
+	var result dto.ToolResultEventData
+	if err := json.Unmarshal([]byte(events[2].Data), &result); err != nil || result.Content != "4" || result.IsError {
+		t.Errorf("got tool result %q", events[2].Data)
+	}
+}
+
+func TestStreamConversationErrorEvent(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.ChatTurn{Status: http.StatusNotFound, Error: "model not found"})
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{})
+
+	rec := postChat(e, `{"prompt":"hello"}`)
+
+	// The stream has already started, so errors are reported in-stream
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	events, _ := testsupport.ReadSSE(rec.Body)
+	if len(events) != 2 || events[1].Event != "error" || !strings.Contains(events[1].Data, "model not found") {
+		t.Errorf("got events %+v", events)
+	}
+}
+
+func TestStreamConversationRejectsBadRequests(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{MaxPromptChars: 10})
+
+	cases := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"invalid json", `{`, http.StatusBadRequest},
+		{"no prompt", `{}`, http.StatusBadRequest},
+		{"system message in history", `{"prompt":"x","history":[{"role":"system","content":"y"}]}`, http.StatusBadRequest},
+		{"prompt too long", `{"prompt":"this prompt is too long"}`, http.StatusRequestEntityTooLarge},
+		{"resource without MCP", `{"prompt":"x","resources":["system://metrics"]}`, http.StatusBadRequest},
+		{"prompt library disabled", `{"prompt":"x","system_prompt":"greeter"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := postChat(e, tc.body); rec.Code != tc.status {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+		})
+	}
+
+	if n := len(fake.ChatRequests()); n != 0 {
+		t.Errorf("rejected requests reached the model: %d", n)
+	}
+}
+
+func TestStreamMissingPrompt(t *testing.T) {
+	e := newTestServer(t, testsupport.NewFakeOllama(t), nil, ollama.ChatLimits{})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ollama/chat", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d", rec.Code)
+	}
+}
+
+func TestStreamClientDisconnect(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("first")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn)
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{})
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/ollama/chat?prompt=hi", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	// Read the first events, then go away while the model is still generating
+	reader := testsupport.NewSSEReader(resp.Body)
+	id := generationID(t, nextEvent(t, reader, "start"))
+	nextEvent(t, reader, "token")
+	cancel()
+	resp.Body.Close()
+
+	// The handler must return, which lets the server close without waiting
+	done := make(chan struct{})
+	go func() {
+		server.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler kept streaming after the client disconnected")
+	}
+
+	// The generation waits for the client to reconnect
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, loopbackRequest(http.MethodGet, "/api/v1/ollama/chat/"+id))
+	if !strings.Contains(rec.Body.String(), `"status":"running"`) {
+		t.Errorf("got status %s", rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, loopbackRequest(http.MethodDelete, "/api/v1/ollama/chat/"+id))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("cancelling: got status %d", rec.Code)
+	}
+}
+
+func TestModels(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ollama/models", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "test-model") {
+		t.Errorf("got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCancelChatFromAnotherConnection(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("partial")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn)
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{})
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/ollama/chat?prompt=hi")
+	if err != nil {
+		t.Fatalf("GET chat: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Wait for the answer to start before cancelling it
+	reader := testsupport.NewSSEReader(resp.Body)
+	start := nextEvent(t, reader, "start")
+	nextEvent(t, reader, "token")
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/v1/ollama/chat/"+generationID(t, start), nil)
+	cancelResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("DELETE chat: %v", err)
+	}
+	cancelResp.Body.Close()
+	if cancelResp.StatusCode != http.StatusAccepted {
+		t.Fatalf("got status %d", cancelResp.StatusCode)
+	}
+
+	if cancelled := nextEvent(t, reader, "cancelled"); !strings.Contains(cancelled.Data, "partial") {
+		t.Errorf("cancelled event does not carry the partial answer: %q", cancelled.Data)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, loopbackRequest(http.MethodGet, "/api/v1/ollama/chat/"+generationID(t, start)))
+	var status dto.GenerationStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || status.Status != dto.GenerationCancelled || status.Content != "partial" {
+		t.Errorf("got status %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/ollama/chat/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown generation: got status %d", rec.Code)
+	}
+}
+
+// nextEvent reads the next event of a stream, which must be of the given type
+func nextEvent(t *testing.T, reader *testsupport.SSEReader, eventType string) testsupport.SSEEvent {
+	t.Helper()
+	event, err := reader.Next()
+	if err != nil {
+		t.Fatalf("reading %s event: %v", eventType, err)
+	}
+	if event.Event != eventType {
+		t.Fatalf("got %s event %q, want %s", event.Event, event.Data, eventType)
+	}
+	return event
+}
+
+func generationID(t *testing.T, start testsupport.SSEEvent) string {
+	t.Helper()
+	var data dto.StartEventData
+	if err := json.Unmarshal([]byte(start.Data), &data); err != nil {
+		t.Fatalf("start event: %v", err)
+	}
+	return data.GenerationID
+}
+
+// loopbackRequest builds a request from the address the test server clients use, which
+// anonymous generations are bound to
+func loopbackRequest(method, target string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	return req
+}
+
+func TestStreamResumesWithLastEventID(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("one", " two", " three")
+	turn.Delay = 50 * time.Millisecond
+	fake.ScriptChat(turn)
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{})
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	// The first connection drops after the first token
+	resp, err := http.Get(server.URL + "/api/v1/ollama/chat?prompt=hi")
+	if err != nil {
+		t.Fatalf("GET chat: %v", err)
+	}
+	reader := testsupport.NewSSEReader(resp.Body)
+	nextEvent(t, reader, "start")
+	token := nextEvent(t, reader, "token")
+	resp.Body.Close()
+
+	// The browser reconnects to the same URL sending the last ID it saw
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/ollama/chat?prompt=hi", nil)
+	req.Header.Set("Last-Event-ID", token.ID)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("reconnecting: %v", err)
+	}
+	defer resp.Body.Close()
+
+	events, err := testsupport.ReadSSE(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadSSE: %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Event)
+	}
+	if got := strings.Join(types, ","); got != "token,token,usage,done" {
+		t.Fatalf("got events %s after reconnecting", got)
+	}
+	if !strings.Contains(events[len(events)-1].Data, "one two three") {
+		t.Errorf("got done %q", events[len(events)-1].Data)
+	}
+	if n := len(fake.ChatRequests()); n != 1 {
+		t.Errorf("reconnecting started %d generations", n)
+	}
+}
+
+func TestResumeChatReplaysFinishedGeneration(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hi", " there"))
+	e := newTestServer(t, fake, nil, ollama.ChatLimits{})
+
+	events, err := testsupport.ReadSSE(postChat(e, `{"prompt":"hello"}`).Body)
+	if err != nil || len(events) != 5 {
+		t.Fatalf("got %d events, %v", len(events), err)
+	}
+	id := generationID(t, events[0])
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ollama/chat/"+id+"/events?last_event_id=3", nil))
+	replayed, err := testsupport.ReadSSE(rec.Body)
+	if err != nil {
+		t.Fatalf("ReadSSE: %v", err)
+	}
+	if len(replayed) != 2 || replayed[0] != events[3] || replayed[1] != events[4] {
+		t.Errorf("got replayed events %+v", replayed)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ollama/chat/"+id+"/events", nil)
+	req.Header.Set("Last-Event-ID", "other:1")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("event ID of another generation: got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ollama/chat/unknown/events", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown generation: got status %d", rec.Code)
+	}
+}
+
+func TestQueueRefusalIsAPlainServiceUnavailable(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config ollama_infra.QueueConfig
+	}{
+		{"full", ollama_infra.QueueConfig{MaxConcurrent: 1}},
+		{"timeout", ollama_infra.QueueConfig{MaxConcurrent: 1, MaxLength: 1, WaitTimeout: 20 * time.Millisecond}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := testsupport.NewFakeOllama(t)
+			busy := testsupport.TextTurn("busy")
+			busy.Chunks = busy.Chunks[:1]
+			busy.Hang = true
+			fake.ScriptChat(busy)
+
+			config := ollama_infra.DefaultClientConfig()
+			config.MaxRetries = 0
+			queue := ollama_infra.NewQueue(ollama_infra.NewOllamaClientWithConfig(fake.URL(), config), tc.config)
+			e := newTestServerWith(queue, nil, ollama.ChatLimits{})
+			server := httptest.NewServer(e)
+			defer server.Close()
+
+			// The first chat holds the only slot
+			resp, err := http.Get(server.URL + "/api/v1/ollama/chat?prompt=hi")
+			if err != nil {
+				t.Fatalf("GET chat: %v", err)
+			}
+			reader := testsupport.NewSSEReader(resp.Body)
+			id := generationID(t, nextEvent(t, reader, "start"))
+			resp.Body.Close()
+			defer e.ServeHTTP(httptest.NewRecorder(), loopbackRequest(http.MethodDelete, "/api/v1/ollama/chat/"+id))
+
+			if rec := postChat(e, `{"prompt":"second"}`); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"error"`) {
+				t.Errorf("chat: got %d %q", rec.Code, rec.Body)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/ollama/generate", strings.NewReader(`{"prompt":"third"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusServiceUnavailable || rec.Header().Get(echo.HeaderContentType) == "text/event-stream" {
+				t.Errorf("generate: got %d %q", rec.Code, rec.Body)
+			}
+		})
+	}
+}
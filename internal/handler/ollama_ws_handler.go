@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+)
+
+const (
+	// wsPingInterval is how often the server pings a WebSocket client. A client that
+	// sends nothing, not even a pong, for two intervals is disconnected.
+	wsPingInterval = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+	// wsMaxQueued is how many messages a session can queue behind the running generation
+	wsMaxQueued = 8
+)
+
+// WebSocket serves the bidirectional chat protocol: the client sends chat messages,
+// tool approvals, cancellations and pongs; the server streams the events of each
+// generation. Messages sent while a generation runs are queued, and every answer is
+// kept as history for the next message of the session.
+func (h *ollamaHandler) WebSocket(c echo.Context) error {
+	caller, admin := callerFromContext(c)
+
+	// Credentials are bearer tokens, never cookies, so a page from another origin gains
+	// nothing by opening the socket and any origin is accepted
+	server := websocket.Server{Handler: func(conn *websocket.Conn) {
+		session := &wsSession{
+			conn:     conn,
+			chatUC:   h.chatUC,
+			caller:   caller,
+			admin:    admin,
+			events:   make(chan dto.StreamEvent),
+			followed: make(chan struct{}),
+		}
+		if err := session.run(c.Request().Context()); err != nil {
+			slog.InfoContext(c.Request().Context(), "WebSocket session ended", "reason", err)
+		}
+	}}
+	server.ServeHTTP(c.Response(), c.Request())
+
+	return nil
+}
+
+// wsSession is one WebSocket connection. Only the run loop writes to the connection.
+type wsSession struct {
+	conn   *websocket.Conn
+	chatUC *ollama.StreamChatUsecase
+	caller *dto.Caller
+	admin  bool
+
+	history []dto.OllamaChatMessage
+	queue   []dto.ChatRequest
+
+	// current is the generation being streamed and turn the messages that started it
+	current string
+	turn    []dto.OllamaChatMessage
+
+	events   chan dto.StreamEvent
+	followed chan struct{}
+}
+
+func (s *wsSession) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	incoming := make(chan []byte)
+	readErr := make(chan error, 1)
+	go s.read(ctx, incoming, readErr)
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case raw := <-incoming:
+			err = s.handle(ctx, raw)
+		case event := <-s.events:
+			err = s.forward(event)
+		case <-s.followed:
+			s.current, s.turn = "", nil
+			if len(s.queue) > 0 {
+				next := s.queue[0]
+				s.queue = s.queue[1:]
+				err = s.start(ctx, next)
+			}
+		case <-ping.C:
+			err = s.send(dto.WSServerMessage{Type: dto.WSMessagePing})
+		case err = <-readErr:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// read receives client messages until the connection fails or goes quiet
+func (s *wsSession) read(ctx context.Context, incoming chan<- []byte, readErr chan<- error) {
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(2 * wsPingInterval))
+
+		var raw []byte
+		if err := websocket.Message.Receive(s.conn, &raw); err != nil {
+			readErr <- err
+			return
+		}
+		select {
+		case incoming <- raw:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *wsSession) handle(ctx context.Context, raw []byte) error {
+	var msg dto.WSClientMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return s.sendError("invalid message: " + err.Error())
+	}
+
+	switch msg.Type {
+	case dto.WSMessageChat:
+		chat := msg.ChatRequest
+		if chat.Prompt == "" && chat.MCPPrompt == "" {
+			return s.sendError("field 'prompt' or 'mcp_prompt' is required")
+		}
+		if !validHistory(chat.History) {
+			return s.sendError("history may only contain user, assistant and tool messages")
+		}
+		if s.current != "" {
+			if len(s.queue) >= wsMaxQueued {
+				return s.sendError(fmt.Sprintf("too many queued messages (at most %d)", wsMaxQueued))
+			}
+			s.queue = append(s.queue, chat)
+			return s.send(dto.WSServerMessage{Type: dto.WSMessageQueued, Data: dto.QueuedEventData{Position: len(s.queue)}})
+		}
+		return s.start(ctx, chat)
+
+	case dto.WSMessageApprove:
+		if s.current == "" {
+			return s.sendError("no generation is running")
+		}
+		if err := s.chatUC.Generations().Approve(s.current, msg.ToolCallID, msg.Approved, s.caller, s.admin); err != nil {
+			return s.sendError(err.Error())
+		}
+		return nil
+
+	case dto.WSMessageCancel:
+		if s.current == "" {
+			return s.sendError("no generation is running")
+		}
+		if err := s.chatUC.Generations().Cancel(s.current, s.caller, s.admin); err != nil && !errors.Is(err, ollama.ErrGenerationFinished) {
+			return s.sendError(err.Error())
+		}
+		return nil
+
+	case dto.WSMessageTyping, dto.WSMessagePong:
+		// Only keep the connection alive
+		return nil
+
+	default:
+		return s.sendError(fmt.Sprintf("unknown message type %q", msg.Type))
+	}
+}
+
+// start begins a generation with the session history and follows it in the background
+func (s *wsSession) start(ctx context.Context, chat dto.ChatRequest) error {
+	// History sent by the client replaces the one of the session
+	if chat.History != nil {
+		s.history = chat.History
+	}
+	chat.History = slices.Clone(s.history)
+	chat.Caller = s.caller
+
+	// An MCP prompt is rendered here, as history, so its messages stay in the session
+	var turn []dto.OllamaChatMessage
+	if chat.MCPPrompt != "" {
+		rendered, err := s.chatUC.RenderMCPPrompt(ctx, chat.MCPPrompt, chat.MCPPromptArgs)
+		if err != nil {
+			return s.sendError(err.Error())
+		}
+		turn = rendered
+		chat.History = append(chat.History, rendered...)
+		chat.MCPPrompt, chat.MCPPromptArgs = "", nil
+	}
+	if chat.Prompt != "" {
+		turn = append(turn, dto.OllamaChatMessage{Role: "user", Content: chat.Prompt})
+	}
+
+	if err := s.chatUC.Validate(ctx, chat); err != nil {
+		return s.sendError(err.Error())
+	}
+
+	id := s.chatUC.Start(ctx, chat)
+	sub, err := s.chatUC.Generations().Subscribe(id, s.caller, s.admin)
+	if err != nil {
+		return s.sendError(err.Error())
+	}
+	s.current, s.turn = id, turn
+
+	go func() {
+		sub.Stream(ctx, 0, func(event dto.StreamEvent) error {
+			select {
+			case s.events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		select {
+		case s.followed <- struct{}{}:
+		case <-ctx.Done():
+		}
+	}()
+
+	return nil
+}
+
+// forward sends a stream event and records finished answers in the session history
+func (s *wsSession) forward(event dto.StreamEvent) error {
+	var answer string
+	switch data := event.Data.(type) {
+	case dto.DoneEventData:
+		answer = data.Content
+	case dto.CancelledEventData:
+		answer = data.Content
+	}
+	if event.Type == dto.StreamEventDone || (event.Type == dto.StreamEventCancelled && answer != "") {
+		s.history = append(s.history, s.turn...)
+		s.history = append(s.history, dto.OllamaChatMessage{Role: "assistant", Content: answer})
+	}
+
+	return s.send(dto.WSServerMessage{
+		Type:         string(event.Type),
+		GenerationID: s.current,
+		ID:           event.ID,
+		Data:         event.Data,
+	})
+}
+
+func (s *wsSession) sendError(message string) error {
+	return s.send(dto.WSServerMessage{Type: dto.WSMessageError, Data: dto.ErrorEventData{Message: message}})
+}
+
+func (s *wsSession) send(msg dto.WSServerMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return websocket.JSON.Send(s.conn, msg)
+}
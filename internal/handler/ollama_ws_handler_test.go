@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+)
+
+// wsMessage is a server message with the data left undecoded
+type wsMessage struct {
+	Type         string          `json:"type"`
+	GenerationID string          `json:"generation_id"`
+	ID           int64           `json:"id"`
+	Data         json.RawMessage `json:"data"`
+}
+
+func dialChat(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/ollama/ws"
+	conn, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func wsSend(t *testing.T, conn *websocket.Conn, msg any) {
+	t.Helper()
+	if err := websocket.JSON.Send(conn, msg); err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+}
+
+// wsReceiveUntil reads messages until one of the given type arrives and returns them all
+func wsReceiveUntil(t *testing.T, conn *websocket.Conn, msgType string) []wsMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var messages []wsMessage
+	for {
+		var msg wsMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			t.Fatalf("waiting for %s, got %+v: %v", msgType, messages, err)
+		}
+		messages = append(messages, msg)
+		if msg.Type == msgType {
+			return messages
+		}
+	}
+}
+
+func messageTypes(messages []wsMessage) string {
+	var types []string
+	for _, msg := range messages {
+		types = append(types, msg.Type)
+	}
+	return strings.Join(types, ",")
+}
+
+func TestWebSocketChatKeepsHistory(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hi", " there"), testsupport.TextTurn("Again"))
+	server := httptest.NewServer(newTestServer(t, fake, nil, ollama.ChatLimits{}))
+	defer server.Close()
+	conn := dialChat(t, server)
+
+	wsSend(t, conn, map[string]any{"type": "message", "prompt": "hello"})
+	first := wsReceiveUntil(t, conn, "done")
+	if got := messageTypes(first); got != "start,token,token,usage,done" {
+		t.Fatalf("got messages %s", got)
+	}
+	if first[0].GenerationID == "" || first[1].GenerationID != first[0].GenerationID || first[1].ID != 2 {
+		t.Errorf("events are not tagged with their generation: %+v", first[:2])
+	}
+
+	wsSend(t, conn, map[string]any{"type": "message", "prompt": "once more"})
+	wsReceiveUntil(t, conn, "done")
+
+	messages := fake.ChatRequests()[1].Messages
+	if len(messages) != 4 || messages[1].Content != "hello" || messages[2].Content != "Hi there" || messages[3].Content != "once more" {
+		t.Errorf("second message does not carry the conversation: %+v", messages)
+	}
+}
+
+func TestWebSocketKeepsMCPPromptInHistory(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hi ana"), testsupport.TextTurn("Fine"))
+	client := testsupport.NewMCPClient(t, testsupport.NewMCPServer())
+	server := httptest.NewServer(newTestServer(t, fake, client, ollama.ChatLimits{}))
+	defer server.Close()
+	conn := dialChat(t, server)
+
+	wsSend(t, conn, map[string]any{"type": "message", "mcp_prompt": "greeting", "mcp_prompt_args": map[string]string{"name": "ana"}})
+	wsReceiveUntil(t, conn, "done")
+	wsSend(t, conn, map[string]any{"type": "message", "prompt": "how are you?"})
+	wsReceiveUntil(t, conn, "done")
+
+	messages := fake.ChatRequests()[1].Messages
+	if len(messages) != 4 || messages[1].Content != "Hello, ana" || messages[2].Content != "Hi ana" || messages[3].Content != "how are you?" {
+		t.Errorf("the rendered prompt is not in the history: %+v", messages)
+	}
+	for _, m := range messages {
+		if m.Role == "user" && m.Content == "" {
+			t.Errorf("empty user message in the history: %+v", messages)
+		}
+	}
+}
+
+func TestWebSocketToolApproval(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(
+		testsupport.ToolCallTurn(
+			testsupport.ToolCall("echo", map[string]any{"text": "pong"}),
+			testsupport.ToolCall("add", map[string]any{"a": 1, "b": 2}),
+		),
+		testsupport.TextTurn("ok"),
+	)
+	server := httptest.NewServer(newTestServer(t, fake, testsupport.NewMCPClient(t, testsupport.NewMCPServer()), ollama.ChatLimits{}))
+	defer server.Close()
+	conn := dialChat(t, server)
+
+	wsSend(t, conn, map[string]any{"type": "message", "prompt": "ping", "approve_tools": true})
+	wsReceiveUntil(t, conn, "tool_call")
+	call := wsReceiveUntil(t, conn, "tool_call")
+	var data dto.ToolCallEventData
+	if err := json.Unmarshal(call[0].Data, &data); err != nil || !data.AwaitingApproval {
+		t.Fatalf("tool call is not awaiting approval: %s", call[0].Data)
+	}
+
+	wsSend(t, conn, map[string]any{"type": "approve", "tool_call_id": "call_0_0", "approved": true})
+	wsSend(t, conn, map[string]any{"type": "approve", "tool_call_id": "call_0_1", "approved": false})
+
+	messages := wsReceiveUntil(t, conn, "done")
+	if got := messageTypes(messages); got != "tool_result,tool_result,token,usage,done" {
+		t.Fatalf("got messages %s", got)
+	}
+	var echo, add dto.ToolResultEventData
+	json.Unmarshal(messages[0].Data, &echo)
+	json.Unmarshal(messages[1].Data, &add)
+	if echo.IsError || echo.Content != "pong" {
+		t.Errorf("approved call: got %+v", echo)
+	}
+	if !add.IsError || !strings.Contains(add.Content, "denied") {
+		t.Errorf("denied call: got %+v", add)
+	}
+}
+
+func TestWebSocketCancelAndQueue(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("partial")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn, testsupport.TextTurn("next"))
+	server := httptest.NewServer(newTestServer(t, fake, nil, ollama.ChatLimits{}))
+	defer server.Close()
+	conn := dialChat(t, server)
+
+	wsSend(t, conn, map[string]any{"type": "message", "prompt": "first"})
+	wsReceiveUntil(t, conn, "token")
+
+	// Written while the first answer streams, it waits its turn
+	wsSend(t, conn, map[string]any{"type": "message", "prompt": "second"})
+	queued := wsReceiveUntil(t, conn, "queued")
+	if string(queued[0].Data) != `{"position":1}` {
+		t.Errorf("got queued %s", queued[0].Data)
+	}
+
+	wsSend(t, conn, map[string]any{"type": "cancel"})
+	cancelled := wsReceiveUntil(t, conn, "cancelled")
+	if !strings.Contains(string(cancelled[0].Data), "partial") {
+		t.Errorf("got cancelled %s", cancelled[0].Data)
+	}
+
+	wsReceiveUntil(t, conn, "done")
+	messages := fake.ChatRequests()[1].Messages
+	if last := messages[len(messages)-1]; last.Content != "second" {
+		t.Errorf("queued message was not sent: %+v", messages)
+	}
+	if assistant := messages[len(messages)-2]; assistant.Role != "assistant" || assistant.Content != "partial" {
+		t.Errorf("cancelled answer is not in the history: %+v", messages)
+	}
+}
+
+func TestWebSocketQueueIsBounded(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("partial")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn)
+	for range wsMaxQueued {
+		fake.ScriptChat(testsupport.TextTurn("ok"))
+	}
+	server := httptest.NewServer(newTestServer(t, fake, nil, ollama.ChatLimits{}))
+	defer server.Close()
+	conn := dialChat(t, server)
+
+	wsSend(t, conn, map[string]any{"type": "message", "prompt": "first"})
+	wsReceiveUntil(t, conn, "token")
+
+	for range wsMaxQueued {
+		wsSend(t, conn, map[string]any{"type": "message", "prompt": "more"})
+		wsReceiveUntil(t, conn, "queued")
+	}
+	wsSend(t, conn, map[string]any{"type": "message", "prompt": "one too many"})
+	if reply := wsReceiveUntil(t, conn, "error"); !strings.Contains(string(reply[0].Data), "too many queued messages") {
+		t.Errorf("got %s", reply[0].Data)
+	}
+
+	// The queued messages are still answered
+	wsSend(t, conn, map[string]any{"type": "cancel"})
+	for range wsMaxQueued {
+		wsReceiveUntil(t, conn, "done")
+	}
+	if n := len(fake.ChatRequests()); n != wsMaxQueued+1 {
+		t.Errorf("got %d chat requests, want %d", n, wsMaxQueued+1)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	server := httptest.NewServer(newTestServer(t, fake, nil, ollama.ChatLimits{}))
+	defer server.Close()
+	conn := dialChat(t, server)
+
+	for _, tc := range []struct {
+		msg  string
+		want string
+	}{
+		{`{"type":"shout"}`, "unknown message type"},
+		{`not json`, "invalid message"},
+		{`{"type":"message"}`, "is required"},
+		{`{"type":"cancel"}`, "no generation is running"},
+		{`{"type":"approve","tool_call_id":"call_0_0","approved":true}`, "no generation is running"},
+	} {
+		if err := websocket.Message.Send(conn, tc.msg); err != nil {
+			t.Fatalf("sending: %v", err)
+		}
+		reply := wsReceiveUntil(t, conn, "error")
+		if !strings.Contains(string(reply[0].Data), tc.want) {
+			t.Errorf("%s: got %s", tc.msg, reply[0].Data)
+		}
+	}
+
+	// The session survives bad messages
+	wsSend(t, conn, map[string]any{"type": "typing"})
+	if len(fake.ChatRequests()) != 0 {
+		t.Error("a chat was started")
+	}
+}
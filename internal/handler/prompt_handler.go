@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/dto"
+	promptstore "github.com/metalpoch/local-synapse/internal/infrastructure/prompt_store"
+	"github.com/metalpoch/local-synapse/internal/usecase/prompt"
+)
+
+type promptHandler struct {
+	promptUC *prompt.PromptUsecase
+}
+
+func NewPromptHandler(promptUC *prompt.PromptUsecase) *promptHandler {
+	return &promptHandler{promptUC}
+}
+
+func (h *promptHandler) List(c echo.Context) error {
+	prompts, err := h.promptUC.List(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, prompts)
+}
+
+func (h *promptHandler) Get(c echo.Context) error {
+	p, err := h.promptUC.Get(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return c.JSON(promptErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, p)
+}
+
+func (h *promptHandler) Create(c echo.Context) error {
+	var req dto.PromptTemplate
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+
+	p, err := h.promptUC.Create(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(promptErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, p)
+}
+
+func (h *promptHandler) Update(c echo.Context) error {
+	var req dto.PromptTemplate
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+	req.Name = c.Param("name")
+
+	p, err := h.promptUC.Update(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(promptErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, p)
+}
+
+func (h *promptHandler) Delete(c echo.Context) error {
+	if err := h.promptUC.Delete(c.Request().Context(), c.Param("name")); err != nil {
+		return c.JSON(promptErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Render previews a prompt with the given variables
+func (h *promptHandler) Render(c echo.Context) error {
+	var req dto.RenderPromptRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request body"})
+	}
+
+	name := c.Param("name")
+	content, err := h.promptUC.Render(c.Request().Context(), name, dto.PromptVariables{
+		UserName: req.UserName,
+		Tools:    req.Tools,
+		Args:     req.Args,
+	})
+	if err != nil {
+		return c.JSON(promptErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, dto.RenderPromptResponse{Name: name, Content: content})
+}
+
+func promptErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, promptstore.ErrPromptNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, promptstore.ErrPromptExists):
+		return http.StatusConflict
+	case errors.Is(err, prompt.ErrInvalidPrompt), errors.Is(err, prompt.ErrMissingArgument):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+// Provider is an inference server able to stream chats with tools, list its models
+// and compute embeddings. Requests and responses use the Ollama wire format, which
+// other providers translate to and from.
+type Provider interface {
+	StreamChatRequest(ctx context.Context, request dto.OllamaChatRequest, onChunk func(dto.OllamaChatResponse) error) error
+	ListModels(ctx context.Context) ([]dto.OllamaModel, error)
+	Embed(ctx context.Context, request dto.OllamaEmbedRequest) (*dto.OllamaEmbedResponse, error)
+}
+
+// Router dispatches each request to the provider configured for its model,
+// falling back to a default provider for unlisted models
+type Router struct {
+	fallback Provider
+	routes   map[string]Provider
+}
+
+// NewRouter creates a provider router. routes maps model names to the provider serving them.
+func NewRouter(fallback Provider, routes map[string]Provider) *Router {
+	if routes == nil {
+		routes = map[string]Provider{}
+	}
+	return &Router{fallback: fallback, routes: routes}
+}
+
+func (r *Router) providerFor(model string) Provider {
+	if p, ok := r.routes[model]; ok {
+		return p
+	}
+	return r.fallback
+}
+
+func (r *Router) StreamChatRequest(
+	ctx context.Context,
+	request dto.OllamaChatRequest,
+	onChunk func(dto.OllamaChatResponse) error,
+) error {
+	return r.providerFor(request.Model).StreamChatRequest(ctx, request, onChunk)
+}
+
+func (r *Router) Embed(ctx context.Context, request dto.OllamaEmbedRequest) (*dto.OllamaEmbedResponse, error) {
+	return r.providerFor(request.Model).Embed(ctx, request)
+}
+
+// ListModels merges the models of every provider. Providers that fail are skipped
+// unless all of them fail.
+func (r *Router) ListModels(ctx context.Context) ([]dto.OllamaModel, error) {
+	providers := []Provider{r.fallback}
+	seen := map[Provider]bool{r.fallback: true}
+	for _, p := range r.routes {
+		if !seen[p] {
+			seen[p] = true
+			providers = append(providers, p)
+		}
+	}
+
+	var models []dto.OllamaModel
+	var lastErr error
+	failed := 0
+	names := map[string]bool{}
+
+	for _, p := range providers {
+		list, err := p.ListModels(ctx)
+		if err != nil {
+			lastErr = err
+			failed++
+			continue
+		}
+		for _, m := range list {
+			if !names[m.Name] {
+				names[m.Name] = true
+				models = append(models, m)
+			}
+		}
+	}
+
+	if failed == len(providers) {
+		return nil, fmt.Errorf("failed to list models: %w", lastErr)
+	}
+
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	return models, nil
+}
@@ -0,0 +1,205 @@
+package mcpclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
+)
+
+type MCPClient interface {
+	Initialize(ctx context.Context) error
+	// ServerInfo returns what the server reported during Initialize, or nil before it
+	ServerInfo() *mcp.InitializeResult
+	Ping(ctx context.Context) error
+	ListTools(ctx context.Context) ([]mcp.Tool, error)
+	CallTool(ctx context.Context, name string, args map[string]any) (*mcp.CallToolResult, error)
+	ListPrompts(ctx context.Context) ([]mcp.Prompt, error)
+	GetPrompt(ctx context.Context, name string, args map[string]string) (*mcp.GetPromptResult, error)
+	ListResources(ctx context.Context) ([]mcp.Resource, []mcp.ResourceTemplate, error)
+	ReadResource(ctx context.Context, uri string) ([]mcp.ResourceContents, error)
+	// OnToolsChanged registers fn to be called when the server reports that its tool list changed
+	OnToolsChanged(fn func())
+	Close() error
+}
+
+// sessionClient is an MCP session with one server; the stdio, HTTP and in-process
+// constructors only differ in the transport they give it
+type sessionClient struct {
+	client *client.Client
+
+	mu           sync.RWMutex
+	initResult   *mcp.InitializeResult
+	toolsChanged []func()
+}
+
+// newSessionClient wraps an MCP client built for any transport
+func newSessionClient(c *client.Client) *sessionClient {
+	sc := &sessionClient{client: c}
+	c.OnNotification(sc.handleNotification)
+	return sc
+}
+
+func (c *sessionClient) Initialize(ctx context.Context) error {
+	// The stdio transport is already started by NewStdioMCPClient; Start is idempotent
+	// and wires up the notification handlers used by OnToolsChanged
+	if err := c.client.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start mcp client: %w", err)
+	}
+
+	// Initialize the MCP session
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    "local-synapse-api",
+		Version: "1.0.0",
+	}
+	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
+
+	result, err := c.client.Initialize(ctx, initRequest)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mcp session: %w", err)
+	}
+
+	c.mu.Lock()
+	c.initResult = result
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *sessionClient) ServerInfo() *mcp.InitializeResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.initResult
+}
+
+func (c *sessionClient) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx)
+}
+
+func (c *sessionClient) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	ctx, span := startSpan(ctx, mcp.MethodToolsList, "")
+	request := mcp.ListToolsRequest{}
+	resp, err := c.client.ListTools(ctx, request)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Tools, nil
+}
+
+func (c *sessionClient) CallTool(ctx context.Context, name string, args map[string]any) (*mcp.CallToolResult, error) {
+	ctx, span := startSpan(ctx, mcp.MethodToolsCall, name, semconv.GenAIToolName(name))
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = args
+	// The server can correlate the call with the API request and the trace that caused it
+	meta := map[string]any{}
+	if id := logging.RequestID(ctx); id != "" {
+		meta["request_id"] = id
+	}
+	tracing.InjectMap(ctx, meta)
+	if len(meta) > 0 {
+		request.Params.Meta = &mcp.Meta{AdditionalFields: meta}
+	}
+
+	start := time.Now()
+	resp, err := c.client.CallTool(ctx, request)
+	if err != nil {
+		slog.DebugContext(ctx, "MCP tool call failed", "tool", name, "duration", time.Since(start), "error", err)
+		tracing.End(span, err)
+		return nil, err
+	}
+	slog.DebugContext(ctx, "MCP tool call finished", "tool", name, "duration", time.Since(start), "is_error", resp.IsError)
+	if resp.IsError {
+		span.SetStatus(codes.Error, "tool reported an error")
+	}
+	span.End()
+
+	return resp, nil
+}
+
+func (c *sessionClient) ListPrompts(ctx context.Context) ([]mcp.Prompt, error) {
+	resp, err := c.client.ListPrompts(ctx, mcp.ListPromptsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Prompts, nil
+}
+
+// GetPrompt renders a prompt on the server with the given arguments
+func (c *sessionClient) GetPrompt(ctx context.Context, name string, args map[string]string) (*mcp.GetPromptResult, error) {
+	ctx, span := startSpan(ctx, mcp.MethodPromptsGet, name)
+	request := mcp.GetPromptRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = args
+
+	result, err := c.client.GetPrompt(ctx, request)
+	tracing.End(span, err)
+	return result, err
+}
+
+// ListResources returns the concrete resources and the resource templates served
+func (c *sessionClient) ListResources(ctx context.Context) ([]mcp.Resource, []mcp.ResourceTemplate, error) {
+	resources, err := c.client.ListResources(ctx, mcp.ListResourcesRequest{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	templates, err := c.client.ListResourceTemplates(ctx, mcp.ListResourceTemplatesRequest{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resources.Resources, templates.ResourceTemplates, nil
+}
+
+func (c *sessionClient) ReadResource(ctx context.Context, uri string) ([]mcp.ResourceContents, error) {
+	ctx, span := startSpan(ctx, mcp.MethodResourcesRead, uri)
+	request := mcp.ReadResourceRequest{}
+	request.Params.URI = uri
+
+	resp, err := c.client.ReadResource(ctx, request)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Contents, nil
+}
+
+func (c *sessionClient) OnToolsChanged(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.toolsChanged = append(c.toolsChanged, fn)
+}
+
+// handleNotification calls the callbacks registered for tool list changes
+func (c *sessionClient) handleNotification(notification mcp.JSONRPCNotification) {
+	if notification.Method != mcp.MethodNotificationToolsListChanged {
+		return
+	}
+
+	c.mu.RLock()
+	callbacks := c.toolsChanged
+	c.mu.RUnlock()
+
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+func (c *sessionClient) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,22 @@
+package mcpclient
+
+import (
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
+)
+
+// NewHTTPClient creates an MCP client for a server reached over the streamable HTTP
+// transport instead of a child process. Requests carry the trace context in their
+// headers, so the server's spans join the trace of the chat that called the tool.
+func NewHTTPClient(url string) (MCPClient, error) {
+	httpClient := &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+	c, err := client.NewStreamableHttpClient(url, transport.WithHTTPBasicClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return newSessionClient(c), nil
+}
@@ -0,0 +1,16 @@
+package mcpclient
+
+import (
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// NewInProcessClient creates an MCP client connected directly to a server running in
+// the same process. It behaves like the stdio client; only the transport differs.
+func NewInProcessClient(s *server.MCPServer) (MCPClient, error) {
+	c, err := client.NewInProcessClient(s)
+	if err != nil {
+		return nil, err
+	}
+	return newSessionClient(c), nil
+}
@@ -0,0 +1,21 @@
+package mcpclient
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
+)
+
+// startSpan opens the client span of an MCP request, named "<method> <target>"
+func startSpan(ctx context.Context, method mcp.MCPMethod, target string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	name := string(method)
+	if target != "" {
+		name += " " + target
+	}
+	attrs = append(attrs, attribute.String("mcp.method.name", string(method)))
+	return tracing.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
@@ -5,20 +5,104 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 
 	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
 )
 
+// Client is the set of Ollama operations used by the usecases. It is implemented
+// by a single OllamaClient and by a Pool of them.
+type Client interface {
+	StreamChatRequest(ctx context.Context, request dto.OllamaChatRequest, onChunk func(dto.OllamaChatResponse) error) error
+	ChatRequest(ctx context.Context, request dto.OllamaChatRequest) (*dto.OllamaChatResponse, error)
+	StreamGenerate(ctx context.Context, request dto.OllamaGenerateRequest, onChunk func(dto.OllamaGenerateResponse) error) error
+	Embed(ctx context.Context, request dto.OllamaEmbedRequest) (*dto.OllamaEmbedResponse, error)
+}
+
+// ClientConfig tunes the HTTP behaviour of an OllamaClient
+type ClientConfig struct {
+	// DialTimeout bounds establishing the TCP connection
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for Ollama to start answering, which
+	// includes loading the model into memory
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout is how long idle keep-alive connections are kept
+	IdleConnTimeout time.Duration
+	// MaxRetries is how many times a request is retried on connection failures
+	// and 503 responses (model loading)
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry; it doubles on each attempt
+	RetryBackoff time.Duration
+	// MaxLineSize bounds a single streamed NDJSON line
+	MaxLineSize int
+}
+
+// DefaultClientConfig returns the configuration used by NewOllamaClient
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		DialTimeout:           10 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+		MaxRetries:            2,
+		RetryBackoff:          500 * time.Millisecond,
+		MaxLineSize:           16 << 20,
+	}
+}
+
 // OllamaClient handles HTTP communication with Ollama API
 type OllamaClient struct {
-	baseURL string
+	baseURL    string
+	httpClient *http.Client
+	config     ClientConfig
 }
 
-// NewOllamaClient creates a new Ollama client
+// NewOllamaClient creates a new Ollama client with the default configuration
 func NewOllamaClient(baseURL string) *OllamaClient {
-	return &OllamaClient{baseURL: baseURL}
+	return NewOllamaClientWithConfig(baseURL, DefaultClientConfig())
+}
+
+// NewOllamaClientWithConfig creates a new Ollama client with custom timeouts and retries
+func NewOllamaClientWithConfig(baseURL string, config ClientConfig) *OllamaClient {
+	if config.MaxLineSize <= 0 {
+		config.MaxLineSize = DefaultClientConfig().MaxLineSize
+	}
+
+	return &OllamaClient{
+		baseURL:    baseURL,
+		httpClient: NewHTTPClient(config),
+		config:     config,
+	}
+}
+
+// NewHTTPClient builds the HTTP client of a model server from the timeouts in config.
+// There is no overall timeout: streams legitimately last for minutes. Each attempt,
+// retries included, gets its own HTTP span under the operation span.
+func NewHTTPClient(config ClientConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   config.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	transport.IdleConnTimeout = config.IdleConnTimeout
+
+	return &http.Client{Transport: tracing.Transport(transport)}
+}
+
+// BaseURL returns the Ollama host this client talks to
+func (c *OllamaClient) BaseURL() string {
+	return c.baseURL
 }
 
 // StreamChatRequest sends a chat request to Ollama and streams the response
@@ -28,38 +112,176 @@ func (c *OllamaClient) StreamChatRequest(
 	request dto.OllamaChatRequest,
 	onChunk func(dto.OllamaChatResponse) error,
 ) error {
+	ctx, span := c.startSpan(ctx, semconv.GenAIOperationNameChat, request.Model)
+	gen := newGenerationSpan(span)
+
+	request.Stream = true
+	err := c.stream(ctx, "/api/chat", request, func(line []byte) error {
+		var chatResp dto.OllamaChatResponse
+		if err := json.Unmarshal(line, &chatResp); err != nil {
+			return &MalformedResponseError{Line: string(line), Err: err}
+		}
+		gen.chunk(chatResp.Message.Content != "" || chatResp.Message.Thinking != "" || len(chatResp.Message.ToolCalls) > 0)
+		if chatResp.Done {
+			gen.done(chatResp.DoneReason, chatResp.PromptEvalCount, chatResp.EvalCount,
+				chatResp.LoadDuration, chatResp.PromptEvalDuration, chatResp.EvalDuration, chatResp.TotalDuration)
+		}
+		return onChunk(chatResp)
+	})
+	tracing.End(span, err)
+	return err
+}
+
+// ChatRequest sends a non-streaming chat request to Ollama
+func (c *OllamaClient) ChatRequest(ctx context.Context, request dto.OllamaChatRequest) (*dto.OllamaChatResponse, error) {
+	ctx, span := c.startSpan(ctx, semconv.GenAIOperationNameChat, request.Model)
+
+	request.Stream = false
+
+	var chatResp dto.OllamaChatResponse
+	if err := c.post(ctx, "/api/chat", request, &chatResp); err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+
+	newGenerationSpan(span).done(chatResp.DoneReason, chatResp.PromptEvalCount, chatResp.EvalCount,
+		chatResp.LoadDuration, chatResp.PromptEvalDuration, chatResp.EvalDuration, chatResp.TotalDuration)
+	span.End()
+	return &chatResp, nil
+}
+
+// StreamGenerate sends a raw completion request to Ollama's /api/generate and streams the response
+// onChunk is called for each chunk received from Ollama
+func (c *OllamaClient) StreamGenerate(
+	ctx context.Context,
+	request dto.OllamaGenerateRequest,
+	onChunk func(dto.OllamaGenerateResponse) error,
+) error {
+	ctx, span := c.startSpan(ctx, semconv.GenAIOperationNameTextCompletion, request.Model)
+	gen := newGenerationSpan(span)
+
 	request.Stream = true
-	body, err := json.Marshal(request)
+	err := c.stream(ctx, "/api/generate", request, func(line []byte) error {
+		var genResp dto.OllamaGenerateResponse
+		if err := json.Unmarshal(line, &genResp); err != nil {
+			return &MalformedResponseError{Line: string(line), Err: err}
+		}
+		gen.chunk(genResp.Response != "" || genResp.Thinking != "")
+		if genResp.Done {
+			span.SetAttributes(semconv.GenAIResponseModel(genResp.Model))
+			gen.done(genResp.DoneReason, genResp.PromptEvalCount, genResp.EvalCount,
+				genResp.LoadDuration, genResp.PromptEvalDuration, genResp.EvalDuration, genResp.TotalDuration)
+		}
+		return onChunk(genResp)
+	})
+	tracing.End(span, err)
+	return err
+}
+
+// Embed generates embeddings for every input using Ollama's /api/embed endpoint
+func (c *OllamaClient) Embed(ctx context.Context, request dto.OllamaEmbedRequest) (_ *dto.OllamaEmbedResponse, err error) {
+	ctx, span := c.startSpan(ctx, semconv.GenAIOperationNameEmbeddings, request.Model)
+	defer func() { tracing.End(span, err) }()
+
+	var embedResp dto.OllamaEmbedResponse
+	if err := c.post(ctx, "/api/embed", request, &embedResp); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(
+		semconv.GenAIResponseModel(embedResp.Model),
+		semconv.GenAIUsageInputTokens(embedResp.PromptEvalCount),
+		attribute.Float64("ollama.load_duration", time.Duration(embedResp.LoadDuration).Seconds()),
+	)
+
+	if len(embedResp.Embeddings) != len(request.Input) {
+		return nil, fmt.Errorf("ollama returned %d embeddings for %d inputs", len(embedResp.Embeddings), len(request.Input))
+	}
+
+	return &embedResp, nil
+}
+
+// ListModels returns the models available locally, from /api/tags
+func (c *OllamaClient) ListModels(ctx context.Context) ([]dto.OllamaModel, error) {
+	var tags dto.OllamaTagsResponse
+	if err := c.get(ctx, "/api/tags", &tags); err != nil {
+		return nil, err
+	}
+	return tags.Models, nil
+}
+
+// ListRunning returns the models currently loaded in memory, from /api/ps
+func (c *OllamaClient) ListRunning(ctx context.Context) ([]dto.OllamaRunningModel, error) {
+	var ps dto.OllamaPsResponse
+	if err := c.get(ctx, "/api/ps", &ps); err != nil {
+		return nil, err
+	}
+	return ps.Models, nil
+}
+
+// get sends a GET request and decodes the JSON response into out
+func (c *OllamaClient) get(ctx context.Context, path string, out interface{}) error {
+	resp, err := c.do(ctx, "GET", path, nil)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/chat", bytes.NewBuffer(body))
+	return nil
+}
+
+// post sends a non-streaming request and decodes the JSON response into out
+func (c *OllamaClient) post(ctx context.Context, path string, payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(ctx, "POST", path, body)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ollama returned status %d", resp.StatusCode)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// stream sends a streaming request and calls onLine for every NDJSON line received.
+// Error objects sent by Ollama mid-stream are returned as a *StreamError.
+func (c *OllamaClient) stream(ctx context.Context, path string, payload interface{}, onLine func([]byte) error) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := c.do(ctx, "POST", path, body)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
 	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), c.config.MaxLineSize)
 	for scanner.Scan() {
-		line := scanner.Text()
-		var chatResp dto.OllamaChatResponse
-		if err := json.Unmarshal([]byte(line), &chatResp); err != nil {
-			// Log but continue - some lines might be malformed
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
 			continue
 		}
-
-		if err := onChunk(chatResp); err != nil {
+		if err := streamErrorFrom(line); err != nil {
+			return err
+		}
+		if err := onLine(line); err != nil {
+			var malformed *MalformedResponseError
+			if errors.As(err, &malformed) {
+				return err
+			}
 			return fmt.Errorf("chunk handler error: %w", err)
 		}
 	}
@@ -71,34 +293,72 @@ func (c *OllamaClient) StreamChatRequest(
 	return nil
 }
 
-// ChatRequest sends a non-streaming chat request to Ollama
-func (c *OllamaClient) ChatRequest(ctx context.Context, request dto.OllamaChatRequest) (*dto.OllamaChatResponse, error) {
-	request.Stream = false
-	body, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+// do sends the request and returns the response once Ollama answers with 200.
+// Connection failures and 503 responses (Ollama still loading the model) are
+// retried with exponential backoff.
+func (c *OllamaClient) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	backoff := c.config.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.doOnce(ctx, method, path, body)
+		if err == nil {
+			return resp, nil
+		}
+
+		if attempt >= c.config.MaxRetries || !shouldRetry(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *OllamaClient) doOnce(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/chat", bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		slog.DebugContext(ctx, "Ollama request failed", "backend", c.baseURL, "method", method, "path", path, "error", err)
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
+	slog.DebugContext(ctx, "Ollama request", "backend", c.baseURL, "method", method, "path", path,
+		"status", resp.StatusCode, "duration", time.Since(start))
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+		defer resp.Body.Close()
+		return nil, newStatusError(resp)
 	}
 
-	var chatResp dto.OllamaChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	return resp, nil
+}
+
+// shouldRetry reports whether the request never reached Ollama or Ollama asked us to come back later
+func shouldRetry(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusServiceUnavailable
 	}
 
-	return &chatResp, nil
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
 }
@@ -0,0 +1,194 @@
+package ollama_infra
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+)
+
+func newTestClient(url string) *OllamaClient {
+	config := DefaultClientConfig()
+	config.RetryBackoff = time.Millisecond
+	return NewOllamaClientWithConfig(url, config)
+}
+
+func TestStreamChatRequestStreamsChunks(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hel", "lo"))
+	client := newTestClient(fake.URL())
+
+	var content strings.Builder
+	var done bool
+	err := client.StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "test-model"}, func(chunk dto.OllamaChatResponse) error {
+		content.WriteString(chunk.Message.Content)
+		done = chunk.Done
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamChatRequest: %v", err)
+	}
+
+	if content.String() != "Hello" || !done {
+		t.Errorf("got content %q done %v, want %q done true", content.String(), done, "Hello")
+	}
+	if requests := fake.ChatRequests(); len(requests) != 1 || !requests[0].Stream {
+		t.Errorf("expected one streaming request, got %+v", requests)
+	}
+}
+
+func TestChatRequestAggregatesResponse(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("a", "b"))
+
+	resp, err := newTestClient(fake.URL()).ChatRequest(context.Background(), dto.OllamaChatRequest{Model: "test-model"})
+	if err != nil {
+		t.Fatalf("ChatRequest: %v", err)
+	}
+	if resp.Message.Content != "ab" || !resp.Done {
+		t.Errorf("got %+v", resp)
+	}
+}
+
+func TestStreamChatRequestStatusError(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.ChatTurn{Status: http.StatusNotFound, Error: `model "nope" not found`})
+
+	err := newTestClient(fake.URL()).StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "nope"}, func(dto.OllamaChatResponse) error {
+		t.Error("no chunk expected")
+		return nil
+	})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("expected *StatusError, got %v", err)
+	}
+	if statusErr.StatusCode != http.StatusNotFound || statusErr.Message != `model "nope" not found` {
+		t.Errorf("got %+v", statusErr)
+	}
+}
+
+func TestStreamChatRequestMidStreamError(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("partial")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Error = "out of memory"
+	fake.ScriptChat(turn)
+
+	var chunks int
+	err := newTestClient(fake.URL()).StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "test-model"}, func(dto.OllamaChatResponse) error {
+		chunks++
+		return nil
+	})
+
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) || streamErr.Message != "out of memory" {
+		t.Fatalf("expected *StreamError, got %v", err)
+	}
+	if chunks != 1 {
+		t.Errorf("got %d chunks before the error, want 1", chunks)
+	}
+}
+
+func TestStreamChatRequestRetriesWhileModelLoads(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(
+		testsupport.ChatTurn{Status: http.StatusServiceUnavailable, Error: "loading model"},
+		testsupport.TextTurn("ok"),
+	)
+
+	err := newTestClient(fake.URL()).StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "test-model"}, func(dto.OllamaChatResponse) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamChatRequest: %v", err)
+	}
+	if n := len(fake.ChatRequests()); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestStreamChatRequestDoesNotRetryClientErrors(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.ChatTurn{Status: http.StatusBadRequest, Error: "bad request"})
+
+	err := newTestClient(fake.URL()).StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "test-model"}, func(dto.OllamaChatResponse) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := len(fake.ChatRequests()); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestStreamChatRequestCancelled(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("first")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- newTestClient(fake.URL()).StreamChatRequest(ctx, dto.OllamaChatRequest{Model: "test-model"}, func(dto.OllamaChatResponse) error {
+			// Cancel once the first chunk arrives; the server keeps the stream open
+			cancel()
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not stop after cancellation")
+	}
+}
+
+func TestStreamChatRequestChunkHandlerError(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("a", "b"))
+
+	stop := errors.New("client went away")
+	err := newTestClient(fake.URL()).StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "test-model"}, func(dto.OllamaChatResponse) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("expected the handler error, got %v", err)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.SetModels(dto.OllamaModel{Name: "a"}, dto.OllamaModel{Name: "b"})
+
+	models, err := newTestClient(fake.URL()).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if len(models) != 2 || models[0].Name != "a" || models[1].Name != "b" {
+		t.Errorf("got %+v", models)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+
+	resp, err := newTestClient(fake.URL()).Embed(context.Background(), dto.OllamaEmbedRequest{Model: "embed", Input: []string{"a", "bb"}})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(resp.Embeddings) != 2 || resp.Embeddings[1][0] != 2 {
+		t.Errorf("got %+v", resp.Embeddings)
+	}
+}
@@ -0,0 +1,76 @@
+package ollama_infra
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StatusError is returned when Ollama answers with a non 200 status. Message holds
+// the text of Ollama's {"error": "..."} body when there is one.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ollama returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("ollama returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// StreamError is returned when Ollama reports an error in the middle of a stream
+type StreamError struct {
+	Message string
+}
+
+func (e *StreamError) Error() string {
+	return "ollama stream error: " + e.Message
+}
+
+// MalformedResponseError is returned when a streamed line is not valid JSON
+type MalformedResponseError struct {
+	Line string
+	Err  error
+}
+
+func (e *MalformedResponseError) Error() string {
+	return fmt.Sprintf("malformed response from ollama: %v", e.Err)
+}
+
+func (e *MalformedResponseError) Unwrap() error {
+	return e.Err
+}
+
+// newStatusError reads Ollama's error body from a failed response
+func newStatusError(resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var errBody struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &errBody) == nil && errBody.Error != "" {
+		message = errBody.Error
+	}
+
+	return &StatusError{StatusCode: resp.StatusCode, Message: message}
+}
+
+// streamErrorFrom returns the error carried by a streamed line, if any
+func streamErrorFrom(line []byte) error {
+	if !strings.Contains(string(line), `"error"`) {
+		return nil
+	}
+
+	var errLine struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(line, &errLine) == nil && errLine.Error != "" {
+		return &StreamError{Message: errLine.Error}
+	}
+	return nil
+}
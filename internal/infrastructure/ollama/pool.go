@@ -0,0 +1,377 @@
+package ollama_infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+const (
+	PolicyRoundRobin  = "round-robin"
+	PolicyLeastLoaded = "least-loaded"
+)
+
+var ErrNoBackends = errors.New("no ollama backend available")
+
+// backend tracks the state of a single Ollama host in the pool
+type backend struct {
+	client *OllamaClient
+
+	mu        sync.RWMutex
+	healthy   bool
+	lastError string
+	lastCheck time.Time
+	models    map[string]bool
+	running   map[string]bool
+
+	inFlight atomic.Int64
+	requests atomic.Int64
+	failures atomic.Int64
+}
+
+// Pool spreads requests over several Ollama hosts. Backends are health checked
+// periodically, requests are routed to hosts that have the model (preferring hosts
+// where it is already loaded) and retried on another host when the connection
+// fails before anything was streamed to the caller.
+type Pool struct {
+	backends []*backend
+	policy   string
+	interval time.Duration
+	next     atomic.Uint64
+}
+
+// NewPool creates a backend pool for the given Ollama URLs
+func NewPool(urls []string, policy string, healthInterval time.Duration, clientConfig ClientConfig) (*Pool, error) {
+	if len(urls) == 0 {
+		return nil, ErrNoBackends
+	}
+
+	switch policy {
+	case "":
+		policy = PolicyLeastLoaded
+	case PolicyRoundRobin, PolicyLeastLoaded:
+	default:
+		return nil, fmt.Errorf("unknown load balancing policy %q", policy)
+	}
+
+	p := &Pool{policy: policy, interval: healthInterval}
+	for _, u := range urls {
+		p.backends = append(p.backends, &backend{
+			client:  NewOllamaClientWithConfig(strings.TrimRight(u, "/"), clientConfig),
+			healthy: true, // optimistic until the first health check
+		})
+	}
+
+	return p, nil
+}
+
+// Run health checks every backend until ctx is cancelled
+func (p *Pool) Run(ctx context.Context) {
+	p.checkAll(ctx)
+
+	if p.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkAll(ctx)
+		}
+	}
+}
+
+func (p *Pool) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			p.check(ctx, b)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// check refreshes the health and model lists of a backend
+func (p *Pool) check(ctx context.Context, b *backend) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	models, err := b.client.ListModels(ctx)
+	var running []dto.OllamaRunningModel
+	if err == nil {
+		running, err = b.client.ListRunning(ctx)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastCheck = time.Now()
+	if err != nil {
+		if b.healthy {
+			slog.WarnContext(ctx, "Ollama backend is unhealthy", "backend", b.client.BaseURL(), "error", err)
+		}
+		b.healthy = false
+		b.lastError = err.Error()
+		return
+	}
+
+	if !b.healthy {
+		slog.InfoContext(ctx, "Ollama backend is healthy again", "backend", b.client.BaseURL())
+	}
+	b.healthy = true
+	b.lastError = ""
+	b.models = make(map[string]bool, len(models))
+	for _, m := range models {
+		b.models[normalizeModel(m.Name)] = true
+	}
+	b.running = make(map[string]bool, len(running))
+	for _, m := range running {
+		b.running[normalizeModel(m.Name)] = true
+	}
+}
+
+func (b *backend) markFailed(err error) {
+	b.failures.Add(1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.healthy = false
+	b.lastError = err.Error()
+}
+
+// Status reports the state of every backend
+func (p *Pool) Status() []dto.OllamaBackendStatus {
+	statuses := make([]dto.OllamaBackendStatus, 0, len(p.backends))
+	for _, b := range p.backends {
+		b.mu.RLock()
+		s := dto.OllamaBackendStatus{
+			URL:           b.client.BaseURL(),
+			Healthy:       b.healthy,
+			LastError:     b.lastError,
+			LastCheck:     b.lastCheck,
+			Models:        sortedKeys(b.models),
+			RunningModels: sortedKeys(b.running),
+			InFlight:      b.inFlight.Load(),
+			Requests:      b.requests.Load(),
+			Failures:      b.failures.Load(),
+		}
+		b.mu.RUnlock()
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// candidates orders the backends that should be tried for model, best first
+func (p *Pool) candidates(model string) []*backend {
+	model = normalizeModel(model)
+
+	type scored struct {
+		b       *backend
+		healthy bool
+		hasIt   bool
+		loaded  bool
+	}
+
+	var list []scored
+	anyHasIt := false
+	for _, b := range p.backends {
+		b.mu.RLock()
+		s := scored{
+			b:       b,
+			healthy: b.healthy,
+			// Before the first health check the model list is unknown; assume it is there
+			hasIt:  b.models == nil || b.models[model],
+			loaded: b.running[model],
+		}
+		b.mu.RUnlock()
+		anyHasIt = anyHasIt || s.hasIt
+		list = append(list, s)
+	}
+
+	// Rotate the starting point so ties are spread across backends
+	offset := int(p.next.Add(1)-1) % len(list)
+	rotated := make([]scored, 0, len(list))
+	rotated = append(rotated, list[offset:]...)
+	list = append(rotated, list[:offset]...)
+
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.healthy != b.healthy {
+			return a.healthy
+		}
+		if anyHasIt && a.hasIt != b.hasIt {
+			return a.hasIt
+		}
+		if p.policy == PolicyRoundRobin {
+			return false
+		}
+		if a.loaded != b.loaded {
+			return a.loaded
+		}
+		return a.b.inFlight.Load() < b.b.inFlight.Load()
+	})
+
+	backends := make([]*backend, 0, len(list))
+	for _, s := range list {
+		// Hosts known not to have the model are skipped when another host has it
+		if anyHasIt && !s.hasIt {
+			continue
+		}
+		backends = append(backends, s.b)
+	}
+	return backends
+}
+
+// do runs fn against the best backend for model, failing over to the next one
+// while fn reports that nothing has been streamed to the caller yet
+func (p *Pool) do(ctx context.Context, model string, fn func(c *OllamaClient, started *bool) error) error {
+	var lastErr error
+
+	for _, b := range p.candidates(model) {
+		started := false
+
+		b.inFlight.Add(1)
+		b.requests.Add(1)
+		err := fn(b.client, &started)
+		b.inFlight.Add(-1)
+
+		if err == nil || started || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+
+		slog.WarnContext(ctx, "Ollama backend failed, trying next", "backend", b.client.BaseURL(), "error", err)
+		if !isModelNotFound(err) {
+			b.markFailed(err)
+		}
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return ErrNoBackends
+	}
+	return lastErr
+}
+
+func (p *Pool) StreamChatRequest(
+	ctx context.Context,
+	request dto.OllamaChatRequest,
+	onChunk func(dto.OllamaChatResponse) error,
+) error {
+	return p.do(ctx, request.Model, func(c *OllamaClient, started *bool) error {
+		return c.StreamChatRequest(ctx, request, func(chunk dto.OllamaChatResponse) error {
+			*started = true
+			return onChunk(chunk)
+		})
+	})
+}
+
+func (p *Pool) ChatRequest(ctx context.Context, request dto.OllamaChatRequest) (*dto.OllamaChatResponse, error) {
+	var resp *dto.OllamaChatResponse
+	err := p.do(ctx, request.Model, func(c *OllamaClient, _ *bool) error {
+		var err error
+		resp, err = c.ChatRequest(ctx, request)
+		return err
+	})
+	return resp, err
+}
+
+func (p *Pool) StreamGenerate(
+	ctx context.Context,
+	request dto.OllamaGenerateRequest,
+	onChunk func(dto.OllamaGenerateResponse) error,
+) error {
+	return p.do(ctx, request.Model, func(c *OllamaClient, started *bool) error {
+		return c.StreamGenerate(ctx, request, func(chunk dto.OllamaGenerateResponse) error {
+			*started = true
+			return onChunk(chunk)
+		})
+	})
+}
+
+func (p *Pool) Embed(ctx context.Context, request dto.OllamaEmbedRequest) (*dto.OllamaEmbedResponse, error) {
+	var resp *dto.OllamaEmbedResponse
+	err := p.do(ctx, request.Model, func(c *OllamaClient, _ *bool) error {
+		var err error
+		resp, err = c.Embed(ctx, request)
+		return err
+	})
+	return resp, err
+}
+
+// ListModels returns the union of the models available on the healthy backends
+func (p *Pool) ListModels(ctx context.Context) ([]dto.OllamaModel, error) {
+	var models []dto.OllamaModel
+	var lastErr error
+	seen := map[string]bool{}
+
+	for _, b := range p.backends {
+		list, err := b.client.ListModels(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, m := range list {
+			if !seen[m.Name] {
+				seen[m.Name] = true
+				models = append(models, m)
+			}
+		}
+	}
+
+	if models == nil && lastErr != nil {
+		return nil, lastErr
+	}
+	return models, nil
+}
+
+// isRetryable reports whether err means the backend could not serve the request at all
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusServiceUnavailable ||
+			statusErr.StatusCode == http.StatusBadGateway ||
+			statusErr.StatusCode == http.StatusNotFound
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func isModelNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// normalizeModel makes "llama3" and "llama3:latest" compare equal
+func normalizeModel(name string) string {
+	if !strings.Contains(name, ":") {
+		return name + ":latest"
+	}
+	return name
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,286 @@
+package ollama_infra
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+var (
+	ErrQueueFull    = errors.New("too many requests are waiting for the model server")
+	ErrQueueTimeout = errors.New("timed out waiting for the model server")
+)
+
+// QueueConfig bounds the requests sent to Ollama at once
+type QueueConfig struct {
+	// MaxConcurrent is how many requests run at the same time
+	MaxConcurrent int
+	// MaxLength is how many requests may wait; more are refused with ErrQueueFull
+	MaxLength int
+	// WaitTimeout is how long a request may wait before failing with ErrQueueTimeout
+	WaitTimeout time.Duration
+	// RolePriorities ranks the requests of each role; higher goes first, unlisted roles are 0
+	RolePriorities map[string]int
+}
+
+// Requester identifies who a request is made for, so the queue can take turns between users
+type Requester struct {
+	User string
+	Role string
+}
+
+type requesterKey struct{}
+type queueListenerKey struct{}
+
+// WithRequester tags the requests made with ctx as made for requester
+func WithRequester(ctx context.Context, requester Requester) context.Context {
+	return context.WithValue(ctx, requesterKey{}, requester)
+}
+
+// WithQueueListener registers a function told the position of the requests made with
+// ctx while they wait in the queue; 1 is the next one to run
+func WithQueueListener(ctx context.Context, onPosition func(position int)) context.Context {
+	return context.WithValue(ctx, queueListenerKey{}, onPosition)
+}
+
+// queuedClient is what the queue runs requests on, a Pool or a single client
+type queuedClient interface {
+	Client
+	ListModels(ctx context.Context) ([]dto.OllamaModel, error)
+}
+
+// waiter is a request waiting for a slot
+type waiter struct {
+	user     string
+	priority int
+	arrival  uint64
+	// ready is closed when the request gets a slot
+	ready chan struct{}
+	// position is the last position reported; positions holds the latest unread one
+	position  int
+	positions chan int
+}
+
+// Queue limits the requests running on Ollama at once. Waiting requests are served by
+// priority and, within a priority, taking turns between users, so a user sending many
+// requests cannot starve the others; each user's own requests keep their order.
+type Queue struct {
+	client queuedClient
+	config QueueConfig
+
+	mu       sync.Mutex
+	running  int
+	waiting  []*waiter
+	arrivals uint64
+	// turn counts the slots granted; served records the turn each user was last served on
+	turn   uint64
+	served map[string]uint64
+}
+
+// NewQueue puts a queue in front of client
+func NewQueue(client queuedClient, config QueueConfig) *Queue {
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 1
+	}
+	return &Queue{
+		client: client,
+		config: config,
+		served: map[string]uint64{},
+	}
+}
+
+// Stats reports how many requests are running and waiting
+func (q *Queue) Stats() dto.QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return dto.QueueStats{
+		Running:       q.running,
+		Waiting:       len(q.waiting),
+		MaxConcurrent: q.config.MaxConcurrent,
+		MaxLength:     q.config.MaxLength,
+	}
+}
+
+func (q *Queue) StreamChatRequest(ctx context.Context, request dto.OllamaChatRequest, onChunk func(dto.OllamaChatResponse) error) error {
+	release, err := q.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return q.client.StreamChatRequest(ctx, request, onChunk)
+}
+
+func (q *Queue) ChatRequest(ctx context.Context, request dto.OllamaChatRequest) (*dto.OllamaChatResponse, error) {
+	release, err := q.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return q.client.ChatRequest(ctx, request)
+}
+
+func (q *Queue) StreamGenerate(ctx context.Context, request dto.OllamaGenerateRequest, onChunk func(dto.OllamaGenerateResponse) error) error {
+	release, err := q.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return q.client.StreamGenerate(ctx, request, onChunk)
+}
+
+func (q *Queue) Embed(ctx context.Context, request dto.OllamaEmbedRequest) (*dto.OllamaEmbedResponse, error) {
+	release, err := q.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return q.client.Embed(ctx, request)
+}
+
+// ListModels only reads metadata and is not queued
+func (q *Queue) ListModels(ctx context.Context) ([]dto.OllamaModel, error) {
+	return q.client.ListModels(ctx)
+}
+
+// acquire waits for a slot and returns the function that gives it back
+func (q *Queue) acquire(ctx context.Context) (func(), error) {
+	requester, _ := ctx.Value(requesterKey{}).(Requester)
+	onPosition, _ := ctx.Value(queueListenerKey{}).(func(int))
+
+	q.mu.Lock()
+	if q.running < q.config.MaxConcurrent && len(q.waiting) == 0 {
+		q.grantLocked(requester.User)
+		q.mu.Unlock()
+		return q.release, nil
+	}
+	if len(q.waiting) >= q.config.MaxLength {
+		q.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	q.arrivals++
+	w := &waiter{
+		user:      requester.User,
+		priority:  q.config.RolePriorities[requester.Role],
+		arrival:   q.arrivals,
+		ready:     make(chan struct{}),
+		positions: make(chan int, 1),
+	}
+	q.waiting = append(q.waiting, w)
+	q.updatePositionsLocked()
+	q.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if q.config.WaitTimeout > 0 {
+		timer := time.NewTimer(q.config.WaitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	for err == nil {
+		select {
+		case <-w.ready:
+			return q.release, nil
+		case position := <-w.positions:
+			if onPosition != nil {
+				onPosition(position)
+			}
+		case <-timeout:
+			err = ErrQueueTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-w.ready:
+		// The slot was granted while giving up; pass it on
+		q.running--
+		q.dispatchLocked()
+	default:
+		q.waiting = slices.DeleteFunc(q.waiting, func(other *waiter) bool { return other == w })
+		q.updatePositionsLocked()
+	}
+	return nil, err
+}
+
+func (q *Queue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	q.dispatchLocked()
+}
+
+func (q *Queue) grantLocked(user string) {
+	q.running++
+	q.turn++
+	q.served[user] = q.turn
+}
+
+// dispatchLocked hands the free slots to the waiting requests that go first
+func (q *Queue) dispatchLocked() {
+	for q.running < q.config.MaxConcurrent && len(q.waiting) > 0 {
+		i := nextWaiter(q.waiting, q.served)
+		w := q.waiting[i]
+		q.waiting = slices.Delete(q.waiting, i, i+1)
+		q.grantLocked(w.user)
+		close(w.ready)
+	}
+	if len(q.waiting) == 0 {
+		// Turns only matter while requests compete
+		clear(q.served)
+	}
+	q.updatePositionsLocked()
+}
+
+// updatePositionsLocked tells each waiting request its position, simulating the order
+// in which dispatch would serve them
+func (q *Queue) updatePositionsLocked() {
+	pending := slices.Clone(q.waiting)
+	served := maps.Clone(q.served)
+
+	turn := q.turn
+	for position := 1; len(pending) > 0; position++ {
+		i := nextWaiter(pending, served)
+		w := pending[i]
+		pending = slices.Delete(pending, i, i+1)
+		turn++
+		served[w.user] = turn
+
+		if w.position == position {
+			continue
+		}
+		w.position = position
+		// Keep only the latest position
+		select {
+		case <-w.positions:
+		default:
+		}
+		w.positions <- position
+	}
+}
+
+// nextWaiter picks the request to serve next: highest priority first, then the user
+// served least recently, then the oldest request
+func nextWaiter(waiting []*waiter, served map[string]uint64) int {
+	best := -1
+	bestPriority, bestServed, bestArrival := math.MinInt, uint64(math.MaxUint64), uint64(math.MaxUint64)
+	for i, w := range waiting {
+		s := served[w.user]
+		if w.priority > bestPriority ||
+			(w.priority == bestPriority && s < bestServed) ||
+			(w.priority == bestPriority && s == bestServed && w.arrival < bestArrival) {
+			best, bestPriority, bestServed, bestArrival = i, w.priority, s, w.arrival
+		}
+	}
+	return best
+}
@@ -0,0 +1,194 @@
+package ollama_infra
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+// stubClient announces each embedding request by its model name and holds it until released
+type stubClient struct {
+	started chan string
+	release chan struct{}
+}
+
+func newStubClient() *stubClient {
+	return &stubClient{started: make(chan string, 16), release: make(chan struct{})}
+}
+
+func (s *stubClient) Embed(ctx context.Context, request dto.OllamaEmbedRequest) (*dto.OllamaEmbedResponse, error) {
+	s.started <- request.Model
+	select {
+	case <-s.release:
+		return &dto.OllamaEmbedResponse{Model: request.Model}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *stubClient) StreamChatRequest(context.Context, dto.OllamaChatRequest, func(dto.OllamaChatResponse) error) error {
+	return nil
+}
+
+func (s *stubClient) ChatRequest(context.Context, dto.OllamaChatRequest) (*dto.OllamaChatResponse, error) {
+	return nil, nil
+}
+
+func (s *stubClient) StreamGenerate(context.Context, dto.OllamaGenerateRequest, func(dto.OllamaGenerateResponse) error) error {
+	return nil
+}
+
+func (s *stubClient) ListModels(context.Context) ([]dto.OllamaModel, error) {
+	return nil, nil
+}
+
+func (s *stubClient) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case model := <-s.started:
+		return model
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request started")
+		return ""
+	}
+}
+
+// enqueue sends a request in the background and waits until it is queued or running
+func enqueue(t *testing.T, q *Queue, wg *sync.WaitGroup, ctx context.Context, model string) {
+	t.Helper()
+	before := q.Stats()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Embed(ctx, dto.OllamaEmbedRequest{Model: model})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		after := q.Stats()
+		if after.Waiting+after.Running > before.Waiting+before.Running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s was not queued", model)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func asUser(user, role string) context.Context {
+	return WithRequester(context.Background(), Requester{User: user, Role: role})
+}
+
+func TestQueueTakesTurnsBetweenUsers(t *testing.T) {
+	client := newStubClient()
+	q := NewQueue(client, QueueConfig{MaxConcurrent: 1, MaxLength: 10})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	enqueue(t, q, &wg, asUser("ana", ""), "ana-1")
+	client.next(t)
+
+	// Ana sends several requests before Bob sends one; Bob should not wait for all of them
+	enqueue(t, q, &wg, asUser("ana", ""), "ana-2")
+	enqueue(t, q, &wg, asUser("ana", ""), "ana-3")
+
+	var positions []int
+	var mu sync.Mutex
+	bob := WithQueueListener(asUser("bob", ""), func(position int) {
+		mu.Lock()
+		defer mu.Unlock()
+		positions = append(positions, position)
+	})
+	enqueue(t, q, &wg, bob, "bob-1")
+
+	var order []string
+	for range 3 {
+		client.release <- struct{}{}
+		order = append(order, client.next(t))
+	}
+	client.release <- struct{}{}
+
+	if want := []string{"bob-1", "ana-2", "ana-3"}; !slices.Equal(order, want) {
+		t.Errorf("served %v, want %v", order, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(positions) == 0 || positions[0] != 1 {
+		t.Errorf("bob was told positions %v", positions)
+	}
+}
+
+func TestQueuePriorities(t *testing.T) {
+	client := newStubClient()
+	q := NewQueue(client, QueueConfig{MaxConcurrent: 1, MaxLength: 10, RolePriorities: map[string]int{"admin": 10}})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	enqueue(t, q, &wg, asUser("ana", "user"), "first")
+	client.next(t)
+	enqueue(t, q, &wg, asUser("bob", "user"), "user")
+	enqueue(t, q, &wg, asUser("root", "admin"), "admin")
+
+	client.release <- struct{}{}
+	if got := client.next(t); got != "admin" {
+		t.Errorf("%s was served before the admin", got)
+	}
+	client.release <- struct{}{}
+	client.next(t)
+	client.release <- struct{}{}
+}
+
+func TestQueueFull(t *testing.T) {
+	client := newStubClient()
+	q := NewQueue(client, QueueConfig{MaxConcurrent: 1, MaxLength: 1})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	enqueue(t, q, &wg, context.Background(), "running")
+	client.next(t)
+	enqueue(t, q, &wg, context.Background(), "waiting")
+
+	if _, err := q.Embed(context.Background(), dto.OllamaEmbedRequest{Model: "refused"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+
+	client.release <- struct{}{}
+	client.next(t)
+	client.release <- struct{}{}
+}
+
+func TestQueueWaitTimeout(t *testing.T) {
+	client := newStubClient()
+	q := NewQueue(client, QueueConfig{MaxConcurrent: 1, MaxLength: 10, WaitTimeout: 20 * time.Millisecond})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	enqueue(t, q, &wg, context.Background(), "running")
+	client.next(t)
+
+	if _, err := q.Embed(context.Background(), dto.OllamaEmbedRequest{Model: "late"}); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("expected ErrQueueTimeout, got %v", err)
+	}
+	if stats := q.Stats(); stats.Waiting != 0 || stats.Running != 1 {
+		t.Errorf("got %+v after the timeout", stats)
+	}
+
+	// A cancelled request leaves the queue as well
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Embed(ctx, dto.OllamaEmbedRequest{Model: "gone"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	client.release <- struct{}{}
+	wg.Wait()
+	if stats := q.Stats(); stats.Running != 0 || stats.Waiting != 0 {
+		t.Errorf("slots were not given back: %+v", stats)
+	}
+}
@@ -0,0 +1,67 @@
+package ollama_infra
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
+)
+
+var providerOllama = semconv.GenAIProviderNameKey.String("ollama")
+
+// startSpan opens the client span of a model operation, named like the GenAI semantic
+// conventions ask: "<operation> <model>"
+func (c *OllamaClient) startSpan(ctx context.Context, operation attribute.KeyValue, model string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{operation, providerOllama, semconv.GenAIRequestModel(model)}
+	if u, err := url.Parse(c.baseURL); err == nil {
+		attrs = append(attrs, semconv.ServerAddress(u.Hostname()))
+	}
+	return tracing.Tracer().Start(ctx, operation.Value.AsString()+" "+model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// generationSpan follows a streamed answer to mark its first token and record the
+// usage and timings Ollama reports in the last chunk
+type generationSpan struct {
+	span    trace.Span
+	start   time.Time
+	started bool
+}
+
+func newGenerationSpan(span trace.Span) *generationSpan {
+	return &generationSpan{span: span, start: time.Now()}
+}
+
+// chunk is called for every chunk; produced tells whether it carries output
+func (g *generationSpan) chunk(produced bool) {
+	if !produced || g.started {
+		return
+	}
+	g.started = true
+	firstToken := time.Since(g.start)
+	g.span.AddEvent("first_token")
+	g.span.SetAttributes(attribute.Float64("ollama.time_to_first_token", firstToken.Seconds()))
+}
+
+// done records what Ollama reports when it finishes; durations are in nanoseconds
+func (g *generationSpan) done(reason string, promptTokens, outputTokens int, load, promptEval, eval, total int64) {
+	attrs := []attribute.KeyValue{
+		semconv.GenAIUsageInputTokens(promptTokens),
+		semconv.GenAIUsageOutputTokens(outputTokens),
+		attribute.Float64("ollama.load_duration", time.Duration(load).Seconds()),
+		attribute.Float64("ollama.prompt_eval_duration", time.Duration(promptEval).Seconds()),
+		attribute.Float64("ollama.eval_duration", time.Duration(eval).Seconds()),
+		attribute.Float64("ollama.total_duration", time.Duration(total).Seconds()),
+	}
+	if reason != "" {
+		attrs = append(attrs, semconv.GenAIResponseFinishReasons(reason))
+	}
+	g.span.SetAttributes(attrs...)
+}
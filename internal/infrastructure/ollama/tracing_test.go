@@ -0,0 +1,54 @@
+package ollama_infra
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+)
+
+func TestStreamChatRequestRecordsSpan(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hel", "lo"))
+	err := newTestClient(fake.URL()).StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "test-model"}, func(dto.OllamaChatResponse) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamChatRequest: %v", err)
+	}
+
+	var chat sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "chat test-model" {
+			chat = span
+		}
+	}
+	if chat == nil {
+		t.Fatalf("no chat span among %d spans", len(recorder.Ended()))
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range chat.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["gen_ai.usage.input_tokens"].AsInt64() != 10 || attrs["gen_ai.usage.output_tokens"].AsInt64() != 5 {
+		t.Errorf("usage was not recorded: %v", chat.Attributes())
+	}
+	if got := attrs["gen_ai.response.finish_reasons"].AsStringSlice(); len(got) != 1 || got[0] != "stop" {
+		t.Errorf("got finish reasons %v", got)
+	}
+	if events := chat.Events(); len(events) != 1 || events[0].Name != "first_token" {
+		t.Errorf("got events %v, want one first_token", events)
+	}
+}
@@ -0,0 +1,467 @@
+package openai_infra
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
+)
+
+// OpenAIClient talks to an OpenAI compatible HTTP server (llama.cpp server, vLLM,
+// LM Studio, ...) and translates to and from the Ollama wire format used internally
+type OpenAIClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	// maxLineSize bounds a single SSE line; tool call deltas can be large
+	maxLineSize int
+}
+
+// NewOpenAIClient creates a new client with the default configuration. baseURL
+// includes the version prefix, e.g. http://localhost:8080/v1
+func NewOpenAIClient(baseURL, apiKey string) *OpenAIClient {
+	return NewOpenAIClientWithConfig(baseURL, apiKey, ollama_infra.DefaultClientConfig())
+}
+
+// NewOpenAIClientWithConfig creates a new client with the timeouts and the line size
+// of config. Requests are not retried.
+func NewOpenAIClientWithConfig(baseURL, apiKey string, config ollama_infra.ClientConfig) *OpenAIClient {
+	if config.MaxLineSize <= 0 {
+		config.MaxLineSize = ollama_infra.DefaultClientConfig().MaxLineSize
+	}
+	return &OpenAIClient{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		apiKey:      apiKey,
+		httpClient:  ollama_infra.NewHTTPClient(config),
+		maxLineSize: config.MaxLineSize,
+	}
+}
+
+type chatRequest struct {
+	Model         string         `json:"model"`
+	Messages      []chatMessage  `json:"messages"`
+	Tools         []dto.Tool     `json:"tools,omitempty"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+
+	// Sampling options, translated from Ollama's. top_k and min_p are not part of the
+	// OpenAI API but llama.cpp server and vLLM accept them.
+	Temperature      interface{} `json:"temperature,omitempty"`
+	TopP             interface{} `json:"top_p,omitempty"`
+	TopK             interface{} `json:"top_k,omitempty"`
+	MinP             interface{} `json:"min_p,omitempty"`
+	MaxTokens        interface{} `json:"max_tokens,omitempty"`
+	Stop             interface{} `json:"stop,omitempty"`
+	Seed             interface{} `json:"seed,omitempty"`
+	PresencePenalty  interface{} `json:"presence_penalty,omitempty"`
+	FrequencyPenalty interface{} `json:"frequency_penalty,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatMessage struct {
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"`
+	ToolCalls  []toolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+	Name       string      `json:"name,omitempty"`
+}
+
+type contentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+	URL string `json:"url"`
+}
+
+type toolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
+}
+
+type chatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string     `json:"content"`
+			ReasoningContent string     `json:"reasoning_content"`
+			ToolCalls        []toolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *usage `json:"usage"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// StreamChatRequest sends a chat completion request and streams the response as Ollama chunks.
+// Tool call deltas are accumulated and delivered together in the final chunk.
+func (c *OpenAIClient) StreamChatRequest(
+	ctx context.Context,
+	request dto.OllamaChatRequest,
+	onChunk func(dto.OllamaChatResponse) error,
+) error {
+	ctx, span := c.startSpan(ctx, semconv.GenAIOperationNameChat, request.Model)
+	gen := newGenerationSpan(span)
+	err := c.streamChat(ctx, request, func(chunk dto.OllamaChatResponse) error {
+		gen.chunk(chunk.Message.Content != "" || chunk.Message.Thinking != "" || len(chunk.Message.ToolCalls) > 0)
+		if chunk.Done {
+			gen.done(chunk.DoneReason, chunk.PromptEvalCount, chunk.EvalCount)
+		}
+		return onChunk(chunk)
+	})
+	tracing.End(span, err)
+	return err
+}
+
+func (c *OpenAIClient) streamChat(
+	ctx context.Context,
+	request dto.OllamaChatRequest,
+	onChunk func(dto.OllamaChatResponse) error,
+) error {
+	body := chatRequest{
+		Model:         request.Model,
+		Messages:      toChatMessages(request.Messages),
+		Tools:         request.Tools,
+		Stream:        true,
+		StreamOptions: &streamOptions{IncludeUsage: true},
+	}
+	applyOptions(ctx, &body, request.Options)
+
+	resp, err := c.send(ctx, "POST", "/chat/completions", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var calls []*toolCall
+	var finishReason string
+	var tokens usage
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), c.maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("malformed response from provider: %w", err)
+		}
+		if chunk.Usage != nil {
+			tokens = *chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != nil {
+			finishReason = *choice.FinishReason
+		}
+		for _, delta := range choice.Delta.ToolCalls {
+			calls = mergeToolCallDelta(calls, delta)
+		}
+
+		if choice.Delta.Content == "" && choice.Delta.ReasoningContent == "" {
+			continue
+		}
+
+		var out dto.OllamaChatResponse
+		out.Message.Role = "assistant"
+		out.Message.Content = choice.Delta.Content
+		out.Message.Thinking = choice.Delta.ReasoningContent
+		if err := onChunk(out); err != nil {
+			return fmt.Errorf("chunk handler error: %w", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scanner error: %w", err)
+	}
+
+	final := dto.OllamaChatResponse{
+		Done:            true,
+		DoneReason:      finishReason,
+		PromptEvalCount: tokens.PromptTokens,
+		EvalCount:       tokens.CompletionTokens,
+	}
+	final.Message.Role = "assistant"
+	for i, tc := range calls {
+		args := dto.ComponentArguments{}
+		if tc.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+				return fmt.Errorf("invalid arguments for tool call %s: %w", tc.Function.Name, err)
+			}
+		}
+		final.Message.ToolCalls = append(final.Message.ToolCalls, dto.ToolCall{
+			ID: tc.ID,
+			Function: dto.ToolCallFunction{
+				Index:     i,
+				Name:      tc.Function.Name,
+				Arguments: args,
+			},
+		})
+	}
+
+	if err := onChunk(final); err != nil {
+		return fmt.Errorf("chunk handler error: %w", err)
+	}
+
+	return nil
+}
+
+// ListModels returns the models served, from /models
+func (c *OpenAIClient) ListModels(ctx context.Context) ([]dto.OllamaModel, error) {
+	resp, err := c.send(ctx, "GET", "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	models := make([]dto.OllamaModel, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, dto.OllamaModel{Name: m.ID, Model: m.ID})
+	}
+	return models, nil
+}
+
+// Embed generates embeddings using /embeddings
+func (c *OpenAIClient) Embed(ctx context.Context, request dto.OllamaEmbedRequest) (_ *dto.OllamaEmbedResponse, err error) {
+	ctx, span := c.startSpan(ctx, semconv.GenAIOperationNameEmbeddings, request.Model)
+	defer func() { tracing.End(span, err) }()
+
+	body := map[string]interface{}{
+		"model": request.Model,
+		"input": request.Input,
+	}
+	if request.Dimensions > 0 {
+		body["dimensions"] = request.Dimensions
+	}
+
+	resp, err := c.send(ctx, "POST", "/embeddings", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Usage usage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	span.SetAttributes(semconv.GenAIUsageInputTokens(out.Usage.PromptTokens))
+	if len(out.Data) != len(request.Input) {
+		return nil, fmt.Errorf("provider returned %d embeddings for %d inputs", len(out.Data), len(request.Input))
+	}
+
+	sort.Slice(out.Data, func(i, j int) bool { return out.Data[i].Index < out.Data[j].Index })
+
+	embedResp := &dto.OllamaEmbedResponse{
+		Model:           request.Model,
+		Embeddings:      make([][]float32, 0, len(out.Data)),
+		PromptEvalCount: out.Usage.PromptTokens,
+	}
+	for _, d := range out.Data {
+		embedResp.Embeddings = append(embedResp.Embeddings, d.Embedding)
+	}
+
+	return embedResp, nil
+}
+
+// send performs the request and returns the response once the server answers with 200
+func (c *OpenAIClient) send(ctx context.Context, method, path string, payload interface{}) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("provider returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+// toChatMessages converts Ollama messages to the chat completions format
+func toChatMessages(messages []dto.OllamaChatMessage) []chatMessage {
+	out := make([]chatMessage, 0, len(messages))
+	for _, m := range messages {
+		msg := chatMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCallID: m.ToolCallID,
+		}
+
+		if len(m.Images) > 0 {
+			parts := []contentPart{{Type: "text", Text: m.Content}}
+			for _, img := range m.Images {
+				parts = append(parts, contentPart{
+					Type:     "image_url",
+					ImageURL: &imageURL{URL: "data:" + imageType(img) + ";base64," + img},
+				})
+			}
+			msg.Content = parts
+		}
+
+		for i, tc := range m.ToolCalls {
+			args, _ := json.Marshal(tc.Function.Arguments)
+			call := toolCall{ID: tc.ID, Type: "function"}
+			if call.ID == "" {
+				call.ID = fmt.Sprintf("call_%d", i)
+			}
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = string(args)
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+
+		out = append(out, msg)
+	}
+	return out
+}
+
+// applyOptions sets the chat completions fields matching Ollama's options. The ones
+// without an equivalent, like num_ctx (the server sets the context window when it
+// loads the model), are left out.
+func applyOptions(ctx context.Context, body *chatRequest, options map[string]interface{}) {
+	var ignored []string
+	for name, value := range options {
+		switch name {
+		case "temperature":
+			body.Temperature = value
+		case "top_p":
+			body.TopP = value
+		case "top_k":
+			body.TopK = value
+		case "min_p":
+			body.MinP = value
+		case "num_predict":
+			// Ollama uses a negative num_predict for no limit
+			switch n := value.(type) {
+			case float64:
+				if n > 0 {
+					body.MaxTokens = int(n)
+				}
+			case int:
+				if n > 0 {
+					body.MaxTokens = n
+				}
+			}
+		case "stop":
+			body.Stop = value
+		case "seed":
+			body.Seed = value
+		case "presence_penalty":
+			body.PresencePenalty = value
+		case "frequency_penalty":
+			body.FrequencyPenalty = value
+		default:
+			ignored = append(ignored, name)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		slog.DebugContext(ctx, "options without an OpenAI equivalent ignored", "options", ignored)
+	}
+}
+
+// imageType detects the MIME type of a base64 encoded image from its first bytes.
+// PNG is assumed when it is not recognised as an image.
+func imageType(encoded string) string {
+	// 684 base64 characters decode to the 512 bytes DetectContentType looks at
+	head, _ := base64.StdEncoding.DecodeString(encoded[:min(len(encoded), 684)])
+	if mime := http.DetectContentType(head); strings.HasPrefix(mime, "image/") {
+		return mime
+	}
+	return "image/png"
+}
+
+// mergeToolCallDelta folds a streamed tool call fragment into the calls gathered so far
+func mergeToolCallDelta(calls []*toolCall, delta toolCall) []*toolCall {
+	index := len(calls)
+	if delta.Index != nil {
+		index = *delta.Index
+	} else if delta.ID == "" && len(calls) > 0 {
+		// Continuation of the previous call
+		index = len(calls) - 1
+	}
+
+	for len(calls) <= index {
+		calls = append(calls, &toolCall{})
+	}
+
+	call := calls[index]
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	call.Function.Name += delta.Function.Name
+	call.Function.Arguments += delta.Function.Arguments
+	return calls
+}
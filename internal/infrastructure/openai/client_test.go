@@ -0,0 +1,121 @@
+package openai_infra
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+// fakeServer answers /chat/completions with the given SSE lines and records the last
+// request body
+func fakeServer(t *testing.T, lines ...string) (*OpenAIClient, *map[string]any) {
+	t.Helper()
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, line := range lines {
+			fmt.Fprintf(w, "data: %s\n\n", line)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewOpenAIClient(server.URL+"/v1", ""), &body
+}
+
+func TestStreamChatRequestTranslatesTheRequest(t *testing.T) {
+	client, body := fakeServer(t,
+		`{"choices":[{"delta":{"content":"Hi"}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+		`[DONE]`,
+	)
+
+	jpeg := base64.StdEncoding.EncodeToString([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"))
+	var content strings.Builder
+	err := client.StreamChatRequest(context.Background(), dto.OllamaChatRequest{
+		Model:    "m",
+		Messages: []dto.OllamaChatMessage{{Role: "user", Content: "look", Images: []string{jpeg}}},
+		Options:  map[string]interface{}{"temperature": 0.2, "num_predict": 64.0, "num_ctx": 4096, "stop": []string{"\n"}},
+	}, func(chunk dto.OllamaChatResponse) error {
+		content.WriteString(chunk.Message.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamChatRequest: %v", err)
+	}
+	if content.String() != "Hi" {
+		t.Errorf("got content %q", content.String())
+	}
+
+	got := *body
+	if got["temperature"] != 0.2 || got["max_tokens"] != 64.0 || got["num_ctx"] != nil || fmt.Sprint(got["stop"]) != "[\n]" {
+		t.Errorf("options were not translated: %v", got)
+	}
+	parts := got["messages"].([]any)[0].(map[string]any)["content"].([]any)
+	if url := parts[1].(map[string]any)["image_url"].(map[string]any)["url"].(string); !strings.HasPrefix(url, "data:image/jpeg;base64,") {
+		t.Errorf("got image URL %q", url)
+	}
+}
+
+func TestStreamChatRequestRejectsMalformedLines(t *testing.T) {
+	client, _ := fakeServer(t, `{"choices":[{"delta":{"content":"Hi"}}]}`, `{"choices":`, `[DONE]`)
+
+	err := client.StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "m"}, func(dto.OllamaChatResponse) error {
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "malformed response") {
+		t.Errorf("got error %v, want a malformed response error", err)
+	}
+}
+
+func TestStreamChatRequestRecordsSpan(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	client, _ := fakeServer(t,
+		`{"choices":[{"delta":{"content":"Hi"}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+		`[DONE]`,
+	)
+	err := client.StreamChatRequest(context.Background(), dto.OllamaChatRequest{Model: "m"}, func(dto.OllamaChatResponse) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamChatRequest: %v", err)
+	}
+
+	var chat sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "chat m" {
+			chat = span
+		}
+	}
+	if chat == nil {
+		t.Fatalf("no chat span among %d spans", len(recorder.Ended()))
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range chat.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["gen_ai.provider.name"].AsString() != "openai" || attrs["gen_ai.usage.input_tokens"].AsInt64() != 3 || attrs["gen_ai.usage.output_tokens"].AsInt64() != 1 {
+		t.Errorf("got attributes %v", chat.Attributes())
+	}
+	if events := chat.Events(); len(events) != 1 || events[0].Name != "first_token" {
+		t.Errorf("got events %v, want one first_token", events)
+	}
+}
@@ -0,0 +1,59 @@
+package openai_infra
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
+)
+
+// startSpan opens the client span of a model operation, named like the GenAI semantic
+// conventions ask: "<operation> <model>"
+func (c *OpenAIClient) startSpan(ctx context.Context, operation attribute.KeyValue, model string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{operation, semconv.GenAIProviderNameOpenAI, semconv.GenAIRequestModel(model)}
+	if u, err := url.Parse(c.baseURL); err == nil {
+		attrs = append(attrs, semconv.ServerAddress(u.Hostname()))
+	}
+	return tracing.Tracer().Start(ctx, operation.Value.AsString()+" "+model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// generationSpan follows a streamed answer to mark its first token and record the
+// usage reported at the end
+type generationSpan struct {
+	span    trace.Span
+	start   time.Time
+	started bool
+}
+
+func newGenerationSpan(span trace.Span) *generationSpan {
+	return &generationSpan{span: span, start: time.Now()}
+}
+
+// chunk is called for every chunk; produced tells whether it carries output
+func (g *generationSpan) chunk(produced bool) {
+	if !produced || g.started {
+		return
+	}
+	g.started = true
+	g.span.AddEvent("first_token")
+	g.span.SetAttributes(attribute.Float64("openai.time_to_first_token", time.Since(g.start).Seconds()))
+}
+
+func (g *generationSpan) done(reason string, promptTokens, outputTokens int) {
+	attrs := []attribute.KeyValue{
+		semconv.GenAIUsageInputTokens(promptTokens),
+		semconv.GenAIUsageOutputTokens(outputTokens),
+	}
+	if reason != "" {
+		attrs = append(attrs, semconv.GenAIResponseFinishReasons(reason))
+	}
+	g.span.SetAttributes(attrs...)
+}
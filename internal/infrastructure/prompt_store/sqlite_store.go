@@ -0,0 +1,160 @@
+package promptstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+var (
+	ErrPromptNotFound = errors.New("prompt not found")
+	ErrPromptExists   = errors.New("prompt already exists")
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS prompts (
+	name        TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	template    TEXT NOT NULL,
+	arguments   TEXT NOT NULL DEFAULT '[]',
+	created_at  DATETIME NOT NULL,
+	updated_at  DATETIME NOT NULL
+);
+`
+
+// SQLiteStore persists the prompt library in SQLite. The API server and the MCP
+// server open the same file, so prompts managed through the API are also served
+// over MCP.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the database at path and applies the schema
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open prompt store: %w", err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply prompt store schema: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) List(ctx context.Context) ([]dto.PromptTemplate, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT name, description, template, arguments, created_at, updated_at FROM prompts ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompts: %w", err)
+	}
+	defer rows.Close()
+
+	prompts := []dto.PromptTemplate{}
+	for rows.Next() {
+		p, err := scanPrompt(rows)
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, *p)
+	}
+
+	return prompts, rows.Err()
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, name string) (*dto.PromptTemplate, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT name, description, template, arguments, created_at, updated_at FROM prompts WHERE name = ?`, name)
+
+	p, err := scanPrompt(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPromptNotFound
+	}
+	return p, err
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, p dto.PromptTemplate) (*dto.PromptTemplate, error) {
+	args, err := json.Marshal(p.Arguments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode arguments: %w", err)
+	}
+
+	p.CreatedAt = time.Now().UTC()
+	p.UpdatedAt = p.CreatedAt
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO prompts (name, description, template, arguments, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		p.Name, p.Description, p.Template, string(args), p.CreatedAt, p.UpdatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrPromptExists
+		}
+		return nil, fmt.Errorf("failed to insert prompt: %w", err)
+	}
+
+	return &p, nil
+}
+
+func (s *SQLiteStore) Update(ctx context.Context, p dto.PromptTemplate) (*dto.PromptTemplate, error) {
+	args, err := json.Marshal(p.Arguments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode arguments: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE prompts SET description = ?, template = ?, arguments = ?, updated_at = ? WHERE name = ?`,
+		p.Description, p.Template, string(args), time.Now().UTC(), p.Name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update prompt: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrPromptNotFound
+	}
+
+	return s.Get(ctx, p.Name)
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM prompts WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete prompt: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPromptNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPrompt(row scanner) (*dto.PromptTemplate, error) {
+	var p dto.PromptTemplate
+	var args string
+	if err := row.Scan(&p.Name, &p.Description, &p.Template, &args, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan prompt: %w", err)
+	}
+	if err := json.Unmarshal([]byte(args), &p.Arguments); err != nil {
+		return nil, fmt.Errorf("failed to decode arguments of prompt %q: %w", p.Name, err)
+	}
+	return &p, nil
+}
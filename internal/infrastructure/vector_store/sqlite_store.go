@@ -0,0 +1,251 @@
+package vectorstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+var ErrDocumentNotFound = errors.New("document not found")
+
+const schema = `
+CREATE TABLE IF NOT EXISTS documents (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	title      TEXT NOT NULL,
+	source     TEXT NOT NULL,
+	format     TEXT NOT NULL,
+	model      TEXT NOT NULL,
+	created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chunks (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	idx         INTEGER NOT NULL,
+	content     TEXT NOT NULL,
+	page        INTEGER NOT NULL DEFAULT 0,
+	section     TEXT NOT NULL DEFAULT '',
+	embedding   BLOB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_chunks_document ON chunks(document_id);
+`
+
+// SQLiteStore persists document chunks and their embeddings in SQLite.
+// Similarity search is brute force over the stored vectors, which is plenty
+// for a personal knowledge base.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the database at path and applies the schema
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vector store: %w", err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply vector store schema: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// AddDocument stores a document together with its chunks and their embeddings
+func (s *SQLiteStore) AddDocument(
+	ctx context.Context,
+	doc dto.KnowledgeDocument,
+	chunks []dto.KnowledgeChunk,
+	embeddings [][]float32,
+) (*dto.KnowledgeDocument, error) {
+	if len(chunks) != len(embeddings) {
+		return nil, fmt.Errorf("got %d embeddings for %d chunks", len(embeddings), len(chunks))
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	doc.CreatedAt = time.Now().UTC()
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO documents (title, source, format, model, created_at) VALUES (?, ?, ?, ?, ?)`,
+		doc.Title, doc.Source, doc.Format, doc.Model, doc.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert document: %w", err)
+	}
+	if doc.ID, err = res.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("failed to read document id: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO chunks (document_id, idx, content, page, section, embedding) VALUES (?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare chunk insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, chunk := range chunks {
+		if _, err := stmt.ExecContext(ctx,
+			doc.ID, chunk.Index, chunk.Content, chunk.Page, chunk.Section, encodeVector(embeddings[i]),
+		); err != nil {
+			return nil, fmt.Errorf("failed to insert chunk %d: %w", chunk.Index, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit document: %w", err)
+	}
+
+	doc.ChunkCount = len(chunks)
+	return &doc, nil
+}
+
+// ListDocuments returns every stored document, newest first
+func (s *SQLiteStore) ListDocuments(ctx context.Context) ([]dto.KnowledgeDocument, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.id, d.title, d.source, d.format, d.model, d.created_at, COUNT(c.id)
+		FROM documents d LEFT JOIN chunks c ON c.document_id = d.id
+		GROUP BY d.id
+		ORDER BY d.created_at DESC, d.id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	docs := []dto.KnowledgeDocument{}
+	for rows.Next() {
+		var d dto.KnowledgeDocument
+		if err := rows.Scan(&d.ID, &d.Title, &d.Source, &d.Format, &d.Model, &d.CreatedAt, &d.ChunkCount); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		docs = append(docs, d)
+	}
+
+	return docs, rows.Err()
+}
+
+// DeleteDocument removes a document and all of its chunks
+func (s *SQLiteStore) DeleteDocument(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM documents WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	if n == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+// Search returns the k chunks embedded with model that are most similar to query
+func (s *SQLiteStore) Search(ctx context.Context, model string, query []float32, k int) ([]dto.KnowledgePassage, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.id, d.title, d.source, c.idx, c.content, c.page, c.section, c.embedding
+		FROM chunks c JOIN documents d ON d.id = c.document_id
+		WHERE d.model = ?`, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	query = normalize(query)
+	passages := []dto.KnowledgePassage{}
+
+	for rows.Next() {
+		var p dto.KnowledgePassage
+		var blob []byte
+		if err := rows.Scan(
+			&p.Citation.DocumentID, &p.Citation.Title, &p.Citation.Source,
+			&p.Citation.ChunkIndex, &p.Content, &p.Citation.Page, &p.Citation.Section, &blob,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+
+		vector := decodeVector(blob)
+		if len(vector) != len(query) {
+			continue
+		}
+		p.Citation.Score = dot(query, vector)
+		passages = append(passages, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(passages, func(i, j int) bool {
+		return passages[i].Citation.Score > passages[j].Citation.Score
+	})
+	if len(passages) > k {
+		passages = passages[:k]
+	}
+
+	return passages, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// encodeVector stores the unit-normalised vector as little endian float32s,
+// so cosine similarity reduces to a dot product at query time
+func encodeVector(v []float32) []byte {
+	v = normalize(v)
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return v
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return v
+	}
+
+	norm := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, f := range v {
+		out[i] = f / norm
+	}
+	return out
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+
+	// contextKey is where the middleware stores the *Claims of the caller
+	contextKey = "auth.claims"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the JWT claims understood by the API. The subject is the user name.
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// ParseToken validates an HS256 token signed with secret and returns its claims
+func ParseToken(secret, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// RequireRole only lets through requests carrying a valid bearer token with one of the
+// given roles. With no secret configured every request is refused.
+func RequireRole(secret string, roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if secret == "" {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "authentication is not configured (JWT_SECRET)"})
+			}
+
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "missing bearer token"})
+			}
+
+			claims, err := ParseToken(secret, token)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+			}
+
+			for _, role := range roles {
+				if claims.Role == role {
+					c.Set(contextKey, claims)
+					return next(c)
+				}
+			}
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "insufficient role"})
+		}
+	}
+}
+
+// Optional identifies the caller when a bearer token is present. Requests without a
+// token pass through anonymously; invalid tokens are rejected.
+func Optional(secret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" || secret == "" {
+				return next(c)
+			}
+
+			claims, err := ParseToken(secret, token)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+			}
+			c.Set(contextKey, claims)
+			return next(c)
+		}
+	}
+}
+
+// TokenFromQuery accepts the bearer token in a query parameter for clients that cannot
+// set headers, like browser WebSockets. It must run before Optional or RequireRole.
+func TokenFromQuery(param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if token := c.QueryParam(param); token != "" && req.Header.Get(echo.HeaderAuthorization) == "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			}
+			return next(c)
+		}
+	}
+}
+
+// ClaimsFromContext returns the claims stored by RequireRole or Optional, or nil
+func ClaimsFromContext(c echo.Context) *Claims {
+	claims, _ := c.Get(contextKey).(*Claims)
+	return claims
+}
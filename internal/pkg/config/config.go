@@ -1,41 +1,458 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
 )
 
-func ApiEnviroment(port, ollamaUrl, ollamaModel, ollamaSystemPrompt *string) error {
-	ou := os.Getenv("OLLAMA_URL")
-	if ou == "" {
-		return errors.New("error 'OLLAMA_URL' environment variable required.")
+// Config holds every setting of the API and the MCP server. It is read from an optional
+// YAML file and then overridden by the environment variables that are set.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Log       LogConfig       `yaml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Ollama    OllamaConfig    `yaml:"ollama"`
+	Queue     QueueConfig     `yaml:"queue"`
+	OpenAI    OpenAIConfig    `yaml:"openai"`
+	Models    ModelsConfig    `yaml:"models"`
+	Context   ContextConfig   `yaml:"context"`
+	Chat      ChatConfig      `yaml:"chat"`
+	MCP       MCPConfig       `yaml:"mcp"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Limits    LimitsConfig    `yaml:"limits"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Knowledge KnowledgeConfig `yaml:"knowledge"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port"`
+}
+
+// LogConfig selects the log level (debug, info, warn or error) and format (text or
+// json). Prompts and tool arguments are only logged with the debug level.
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// TracingConfig selects where OpenTelemetry spans go: nowhere ("none"), to stdout or to
+// an OTLP/HTTP collector. SampleRatio is the fraction of new traces recorded.
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+// OllamaConfig describes the pool of Ollama backends and the HTTP client used for them
+type OllamaConfig struct {
+	URLs           []string      `yaml:"urls"`
+	LBPolicy       string        `yaml:"lb_policy"`
+	HealthInterval time.Duration `yaml:"health_interval"`
+	DialTimeout    time.Duration `yaml:"dial_timeout"`
+	HeaderTimeout  time.Duration `yaml:"header_timeout"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`
+	MaxRetries     int           `yaml:"max_retries"`
+}
+
+// QueueConfig limits the requests running on Ollama at once, across all backends. The
+// others wait by role priority, taking turns between users, for up to WaitTimeout.
+type QueueConfig struct {
+	MaxConcurrent  int            `yaml:"max_concurrent"`
+	MaxLength      int            `yaml:"max_length"`
+	WaitTimeout    time.Duration  `yaml:"wait_timeout"`
+	RolePriorities map[string]int `yaml:"role_priorities"`
+}
+
+// OpenAIConfig is the optional OpenAI compatible provider (llama.cpp server, vLLM,
+// LM Studio...). Models lists the models routed to it; every other model is served by Ollama.
+type OpenAIConfig struct {
+	BaseURL string   `yaml:"base_url"`
+	APIKey  string   `yaml:"api_key"`
+	Models  []string `yaml:"models"`
+}
+
+// ModelsConfig names the models used by default. The knowledge base is disabled when
+// Embed is empty; EmbedAllowed lists the extra models usable through the embeddings endpoints.
+type ModelsConfig struct {
+	Chat         string   `yaml:"chat"`
+	SystemPrompt string   `yaml:"system_prompt"`
+	Embed        string   `yaml:"embed"`
+	EmbedAllowed []string `yaml:"embed_allowed"`
+}
+
+// ContextConfig controls how conversations are fitted into the model context window
+type ContextConfig struct {
+	NumCtx        int    `yaml:"num_ctx"`
+	ReserveTokens int    `yaml:"reserve_tokens"`
+	Strategy      string `yaml:"strategy"`
+}
+
+// ChatConfig controls the chat generations. GenerationRetention is how long a finished
+// generation can still be looked up and replayed.
+type ChatConfig struct {
+	GenerationRetention time.Duration `yaml:"generation_retention"`
+}
+
+// MCPConfig describes the MCP server started by the API and the resources it exposes.
+// With URL set the API connects to that streamable HTTP server instead of starting Command.
+type MCPConfig struct {
+	Command      string           `yaml:"command"`
+	URL          string           `yaml:"url"`
+	Args         []string         `yaml:"args"`
+	ToolsTTL     time.Duration    `yaml:"tools_ttl"`
+	ToolPolicies dto.ToolPolicies `yaml:"tool_policies"`
+	FileRoots    []string         `yaml:"file_roots"`
+	LogFiles     []string         `yaml:"log_files"`
+}
+
+// AuthConfig holds the HS256 key used to verify bearer tokens. Endpoints that
+// require a role are refused while it is not set.
+type AuthConfig struct {
+	JWTSecret string `yaml:"jwt_secret"`
+}
+
+// LimitsConfig bounds the size of requests. Zero disables a limit.
+type LimitsConfig struct {
+	MaxPromptChars     int `yaml:"max_prompt_chars"`
+	MaxHistoryMessages int `yaml:"max_history_messages"`
+	MaxEmbedInputs     int `yaml:"max_embed_inputs"`
+}
+
+type StorageConfig struct {
+	KnowledgeDB string `yaml:"knowledge_db"`
+	PromptsDB   string `yaml:"prompts_db"`
+}
+
+// KnowledgeConfig tunes the retrieval for the chat. MinScore is the lowest cosine
+// similarity, between -1 and 1, a passage needs to be added to the prompt.
+type KnowledgeConfig struct {
+	MinScore float64 `yaml:"min_score"`
+}
+
+// Default returns the configuration used for everything the file and the environment leave unset
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{Port: 8080},
+		Log:    LogConfig{Level: "info", Format: "text"},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+		Ollama: OllamaConfig{
+			URLs:           []string{"http://localhost:11434"},
+			LBPolicy:       "least-loaded",
+			HealthInterval: 15 * time.Second,
+			DialTimeout:    10 * time.Second,
+			HeaderTimeout:  5 * time.Minute,
+			IdleTimeout:    90 * time.Second,
+			MaxRetries:     2,
+		},
+		Queue: QueueConfig{
+			MaxConcurrent: 4,
+			MaxLength:     64,
+			WaitTimeout:   2 * time.Minute,
+		},
+		Models: ModelsConfig{
+			SystemPrompt: "You are a helpful assistant.",
+		},
+		Context: ContextConfig{Strategy: "sliding-window"},
+		Chat:    ChatConfig{GenerationRetention: 10 * time.Minute},
+		MCP:     MCPConfig{Command: "./mcp"},
+		Limits:  LimitsConfig{MaxEmbedInputs: 2048},
+		Storage: StorageConfig{
+			KnowledgeDB: "knowledge.db",
+			PromptsDB:   "prompts.db",
+		},
+	}
+}
+
+// Load reads the configuration file at path, when it is not empty, on top of the
+// defaults and applies the environment overrides. The result is not validated.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnviroment(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyEnviroment overrides the settings whose environment variable is set
+func (c *Config) applyEnviroment() error {
+	var errs []error
+
+	setString := func(name string, value *string) {
+		if v := os.Getenv(name); v != "" {
+			*value = v
+		}
+	}
+	setList := func(name string, value *[]string) {
+		if v := os.Getenv(name); v != "" {
+			*value = splitList(v)
+		}
+	}
+	setInt := func(name string, value *int) {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error '%s' must be a valid number, got %q", name, v))
+				return
+			}
+			*value = n
+		}
+	}
+	setFloat := func(name string, value *float64) {
+		if v := os.Getenv(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error '%s' must be a valid number, got %q", name, v))
+				return
+			}
+			*value = f
+		}
+	}
+	setDuration := func(name string, value *time.Duration) {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error '%s' must be a valid duration, got %q", name, v))
+				return
+			}
+			*value = d
+		}
+	}
+
+	setInt("PORT", &c.Server.Port)
+	setString("LOG_LEVEL", &c.Log.Level)
+	setString("LOG_FORMAT", &c.Log.Format)
+	setString("TRACING_EXPORTER", &c.Tracing.Exporter)
+	setString("TRACING_OTLP_ENDPOINT", &c.Tracing.OTLPEndpoint)
+	setFloat("TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio)
+
+	if v := os.Getenv("OLLAMA_URL"); v != "" {
+		c.Ollama.URLs = []string{v}
 	}
+	setList("OLLAMA_URLS", &c.Ollama.URLs)
+	setString("OLLAMA_LB_POLICY", &c.Ollama.LBPolicy)
+	setDuration("OLLAMA_HEALTH_INTERVAL", &c.Ollama.HealthInterval)
+	setDuration("OLLAMA_DIAL_TIMEOUT", &c.Ollama.DialTimeout)
+	setDuration("OLLAMA_HEADER_TIMEOUT", &c.Ollama.HeaderTimeout)
+	setDuration("OLLAMA_IDLE_TIMEOUT", &c.Ollama.IdleTimeout)
+	setInt("OLLAMA_MAX_RETRIES", &c.Ollama.MaxRetries)
 
-	om := os.Getenv("OLLAMA_MODEL")
-	if om == "" {
-		return errors.New("error 'OLLAMA_MODEL' environment variable required.")
+	setInt("OLLAMA_MAX_CONCURRENT", &c.Queue.MaxConcurrent)
+	setInt("QUEUE_MAX_LENGTH", &c.Queue.MaxLength)
+	setDuration("QUEUE_TIMEOUT", &c.Queue.WaitTimeout)
+	if v := os.Getenv("QUEUE_ROLE_PRIORITIES"); v != "" {
+		var priorities map[string]int
+		if err := json.Unmarshal([]byte(v), &priorities); err != nil {
+			errs = append(errs, fmt.Errorf("error 'QUEUE_ROLE_PRIORITIES' must be a valid JSON object: %v", err))
+		} else {
+			c.Queue.RolePriorities = priorities
+		}
 	}
 
-	osp := os.Getenv("OLLAMA_SYSTEM_PROMPT")
-	if osp == "" {
-		return errors.New("error 'OLLAMA_SYSTEM_PROMPT' environment variable required.")
+	setString("OPENAI_BASE_URL", &c.OpenAI.BaseURL)
+	setString("OPENAI_API_KEY", &c.OpenAI.APIKey)
+	setList("OPENAI_MODELS", &c.OpenAI.Models)
+
+	setString("OLLAMA_MODEL", &c.Models.Chat)
+	setString("OLLAMA_SYSTEM_PROMPT", &c.Models.SystemPrompt)
+	setString("OLLAMA_EMBED_MODEL", &c.Models.Embed)
+	setList("OLLAMA_EMBED_MODELS", &c.Models.EmbedAllowed)
+
+	setInt("OLLAMA_NUM_CTX", &c.Context.NumCtx)
+	setInt("CONTEXT_RESERVE_TOKENS", &c.Context.ReserveTokens)
+	setString("CONTEXT_STRATEGY", &c.Context.Strategy)
+	setDuration("GENERATION_RETENTION", &c.Chat.GenerationRetention)
+
+	setString("MCP_COMMAND", &c.MCP.Command)
+	setString("MCP_URL", &c.MCP.URL)
+	setDuration("MCP_TOOLS_TTL", &c.MCP.ToolsTTL)
+	setList("MCP_FILE_ROOTS", &c.MCP.FileRoots)
+	setList("MCP_LOG_FILES", &c.MCP.LogFiles)
+	if v := os.Getenv("TOOL_POLICIES"); v != "" {
+		var policies dto.ToolPolicies
+		if err := json.Unmarshal([]byte(v), &policies); err != nil {
+			errs = append(errs, fmt.Errorf("error 'TOOL_POLICIES' must be a valid JSON document: %v", err))
+		} else {
+			c.MCP.ToolPolicies = policies
+		}
+	}
+
+	setString("JWT_SECRET", &c.Auth.JWTSecret)
+
+	setInt("MAX_PROMPT_CHARS", &c.Limits.MaxPromptChars)
+	setInt("MAX_HISTORY_MESSAGES", &c.Limits.MaxHistoryMessages)
+	setInt("MAX_EMBED_INPUTS", &c.Limits.MaxEmbedInputs)
+
+	setString("KNOWLEDGE_DB_PATH", &c.Storage.KnowledgeDB)
+	setString("PROMPTS_DB_PATH", &c.Storage.PromptsDB)
+	setFloat("KNOWLEDGE_MIN_SCORE", &c.Knowledge.MinScore)
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the settings needed by the API and reports every problem at once
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Port 0 picks a free port, which is what the integration tests use
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		fail("server.port (PORT) must be between 0 and 65535, got %d", c.Server.Port)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level (LOG_LEVEL) must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "", "text", "json":
+	default:
+		fail("log.format (LOG_FORMAT) must be 'text' or 'json', got %q", c.Log.Format)
 	}
 
-	p := os.Getenv("PORT")
-	if p == "" {
-		return errors.New("error 'PORT' environment variable required.")
+	switch c.Tracing.Exporter {
+	case "", "none", "stdout", "otlp":
+	default:
+		fail("tracing.exporter (TRACING_EXPORTER) must be 'none', 'stdout' or 'otlp', got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio (TRACING_SAMPLE_RATIO) must be between 0 and 1, got %v", c.Tracing.SampleRatio)
 	}
 
-	if _, err := strconv.Atoi(p); err != nil {
-		return fmt.Errorf("error 'PORT' must be a valid number: %v", err)
+	if len(c.Ollama.URLs) == 0 {
+		fail("ollama.urls (OLLAMA_URL, OLLAMA_URLS) requires at least one backend")
+	}
+	for _, u := range c.Ollama.URLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fail("ollama.urls: %q is not a valid http(s) URL", u)
+		}
+	}
+	switch c.Ollama.LBPolicy {
+	case "", "least-loaded", "round-robin":
+	default:
+		fail("ollama.lb_policy (OLLAMA_LB_POLICY) must be 'least-loaded' or 'round-robin', got %q", c.Ollama.LBPolicy)
+	}
+	if c.Ollama.HealthInterval <= 0 {
+		fail("ollama.health_interval (OLLAMA_HEALTH_INTERVAL) must be positive")
+	}
+	if c.Ollama.DialTimeout < 0 || c.Ollama.HeaderTimeout < 0 || c.Ollama.IdleTimeout < 0 {
+		fail("ollama timeouts must not be negative")
+	}
+	if c.Ollama.MaxRetries < 0 {
+		fail("ollama.max_retries (OLLAMA_MAX_RETRIES) must not be negative")
+	}
+
+	if c.Queue.MaxConcurrent < 1 {
+		fail("queue.max_concurrent (OLLAMA_MAX_CONCURRENT) must be at least 1, got %d", c.Queue.MaxConcurrent)
+	}
+	if c.Queue.MaxLength < 0 {
+		fail("queue.max_length (QUEUE_MAX_LENGTH) must not be negative")
+	}
+	if c.Queue.WaitTimeout < 0 {
+		fail("queue.wait_timeout (QUEUE_TIMEOUT) must not be negative")
 	}
 
-	*port = ":" + p
-	*ollamaUrl = ou
-	*ollamaModel = om
-	*ollamaSystemPrompt = osp
+	if c.OpenAI.BaseURL != "" && len(c.OpenAI.Models) == 0 {
+		fail("openai.models (OPENAI_MODELS) is required when openai.base_url is set")
+	}
 
+	if c.Models.Chat == "" {
+		fail("models.chat (OLLAMA_MODEL) is required")
+	}
+	if strings.TrimSpace(c.Models.SystemPrompt) == "" {
+		fail("models.system_prompt (OLLAMA_SYSTEM_PROMPT) must not be empty")
+	}
+
+	if c.Context.NumCtx < 0 {
+		fail("context.num_ctx (OLLAMA_NUM_CTX) must not be negative")
+	}
+	if c.Context.ReserveTokens < 0 {
+		fail("context.reserve_tokens (CONTEXT_RESERVE_TOKENS) must not be negative")
+	}
+	switch c.Context.Strategy {
+	case "", "sliding-window", "summarize":
+	default:
+		fail("context.strategy (CONTEXT_STRATEGY) must be 'sliding-window' or 'summarize', got %q", c.Context.Strategy)
+	}
+
+	if c.Chat.GenerationRetention <= 0 {
+		fail("chat.generation_retention (GENERATION_RETENTION) must be positive")
+	}
+
+	if c.MCP.Command == "" && c.MCP.URL == "" {
+		fail("mcp.command (MCP_COMMAND) or mcp.url (MCP_URL) is required")
+	}
+	if c.MCP.URL != "" {
+		if parsed, err := url.Parse(c.MCP.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fail("mcp.url (MCP_URL): %q is not a valid http(s) URL", c.MCP.URL)
+		}
+	}
+	if c.MCP.ToolsTTL < 0 {
+		fail("mcp.tools_ttl (MCP_TOOLS_TTL) must not be negative")
+	}
+
+	if c.Limits.MaxPromptChars < 0 || c.Limits.MaxHistoryMessages < 0 || c.Limits.MaxEmbedInputs < 0 {
+		fail("limits must not be negative")
+	}
+
+	if c.Storage.PromptsDB == "" {
+		fail("storage.prompts_db (PROMPTS_DB_PATH) must not be empty")
+	}
+	if c.Models.Embed != "" && c.Storage.KnowledgeDB == "" {
+		fail("storage.knowledge_db (KNOWLEDGE_DB_PATH) is required when models.embed is set")
+	}
+	if c.Knowledge.MinScore < -1 || c.Knowledge.MinScore > 1 {
+		fail("knowledge.min_score (KNOWLEDGE_MIN_SCORE) must be between -1 and 1, got %v", c.Knowledge.MinScore)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
 	return nil
 }
+
+// Addr is the address the HTTP server listens on
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Server.Port)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher reloads the configuration on SIGHUP and whenever the file changes. Only the
+// settings that are safe to change at runtime are applied: the default system prompt,
+// the allow-lists (tool policies and embedding models), the limits and the log level.
+// Changes to anything else are reported and wait for a restart.
+type Watcher struct {
+	path      string
+	mu        sync.Mutex
+	current   *Config
+	modTime   time.Time
+	listeners []func(*Config)
+}
+
+// NewWatcher creates a watcher for the file at path, starting from cfg
+func NewWatcher(path string, cfg *Config) *Watcher {
+	w := &Watcher{path: path, current: cfg}
+	if info, err := os.Stat(path); err == nil {
+		w.modTime = info.ModTime()
+	}
+	return w
+}
+
+// Current returns the configuration in effect
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// OnReload registers fn to be called with the new configuration after every reload
+func (w *Watcher) OnReload(fn func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Reload reads and validates the configuration again and applies the safe settings.
+// The configuration in effect is kept when the new one is invalid.
+func (w *Watcher) Reload() error {
+	next, err := Load(w.path)
+	if err != nil {
+		return err
+	}
+	if err := next.Validate(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	applied := *w.current
+	applied.Models.SystemPrompt = next.Models.SystemPrompt
+	applied.Models.EmbedAllowed = next.Models.EmbedAllowed
+	applied.MCP.ToolPolicies = next.MCP.ToolPolicies
+	applied.Limits = next.Limits
+	applied.Log.Level = next.Log.Level
+
+	for _, section := range restartRequired(&applied, next) {
+		slog.Warn("configuration changed; restart to apply it", "section", section)
+	}
+
+	w.current = &applied
+	listeners := append([]func(*Config){}, w.listeners...)
+	w.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(&applied)
+	}
+	slog.Info("configuration reloaded")
+	return nil
+}
+
+// Run reloads on SIGHUP and polls the file for changes every interval until ctx is done
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.reload()
+		case <-ticker.C:
+			if w.path == "" {
+				continue
+			}
+			info, err := os.Stat(w.path)
+			if err != nil || info.ModTime().Equal(w.modTime) {
+				continue
+			}
+			w.modTime = info.ModTime()
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	if err := w.Reload(); err != nil {
+		slog.Error("configuration reload failed, keeping the current one", "error", err)
+	}
+}
+
+// restartRequired lists the sections of next that differ from the applied configuration.
+// Both already share the safe settings, so any difference needs a restart.
+func restartRequired(applied, next *Config) []string {
+	var changed []string
+	a := reflect.ValueOf(applied).Elem()
+	n := reflect.ValueOf(next).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), n.Field(i).Interface()) {
+			changed = append(changed, a.Type().Field(i).Tag.Get("yaml"))
+		}
+	}
+	return changed
+}
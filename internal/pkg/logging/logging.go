@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// level is shared by every logger created by Setup so it can change at runtime
+var level = new(slog.LevelVar)
+
+// ParseLevel accepts debug, info, warn and error, in any case
+func ParseLevel(name string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return l, nil
+}
+
+// New creates a logger writing text or JSON ("json") lines to w. Every line logged with
+// a context carries the request ID and the attributes added with With.
+func New(w io.Writer, format string, l slog.Level) *slog.Logger {
+	level.Set(l)
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// Setup makes a logger created by New the default one, also for the standard log package
+func Setup(w io.Writer, format string, l slog.Level) {
+	slog.SetDefault(New(w, format, l))
+}
+
+// SetLevel changes the level of the loggers created by New
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// DebugEnabled reports whether debug lines are logged, and with them the content of prompts
+func DebugEnabled(ctx context.Context) bool {
+	return slog.Default().Enabled(ctx, slog.LevelDebug)
+}
+
+// Redact hides text written by users, like prompts or tool arguments, unless debug
+// logging is enabled; only its length is kept
+func Redact(ctx context.Context, text string) string {
+	if DebugEnabled(ctx) {
+		return text
+	}
+	return fmt.Sprintf("[redacted %d chars]", len(text))
+}
+
+type requestIDKey struct{}
+type attrsKey struct{}
+
+// WithRequestID stores the ID of the request served with ctx
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID stored with WithRequestID, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// With adds attributes, as key-value pairs like slog.Logger.With, to every line logged with ctx
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	record := slog.NewRecord(time.Time{}, 0, "", 0)
+	record.Add(args...)
+	next := make([]slog.Attr, len(attrs), len(attrs)+record.NumAttrs())
+	copy(next, attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		next = append(next, attr)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, next)
+}
+
+// contextHandler adds the request ID and the attributes of the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			record.AddAttrs(slog.String("request_id", id))
+		}
+		if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+			record.AddAttrs(attrs...)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// captureLogs makes a JSON logger writing to the returned buffer the default one for the test
+func captureLogs(t *testing.T, l slog.Level) *bytes.Buffer {
+	t.Helper()
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	var buf bytes.Buffer
+	Setup(&buf, "json", l)
+	return &buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, raw := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var line map[string]any
+		if err := json.Unmarshal([]byte(raw), &line); err != nil {
+			t.Fatalf("invalid log line %q: %v", raw, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func serve(e *echo.Echo, header string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/hello?token=secret", nil)
+	if header != "" {
+		req.Header.Set(echo.HeaderXRequestID, header)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddlewareCorrelatesLogLines(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/hello", func(c echo.Context) error {
+		ctx := With(c.Request().Context(), "generation_id", "gen-1")
+		slog.InfoContext(ctx, "inside")
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	rec := serve(e, "")
+	id := rec.Header().Get(echo.HeaderXRequestID)
+	if id == "" {
+		t.Fatal("the response has no request ID")
+	}
+
+	lines := logLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %s", len(lines), buf)
+	}
+	inside, request := lines[0], lines[1]
+	if inside["request_id"] != id || inside["generation_id"] != "gen-1" {
+		t.Errorf("handler line is not correlated: %v", inside)
+	}
+	if request["request_id"] != id || request["path"] != "/hello" || request["status"] != float64(http.StatusNoContent) {
+		t.Errorf("got request line %v", request)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("the query string was logged: %s", buf)
+	}
+}
+
+func TestMiddlewareKeepsClientRequestID(t *testing.T) {
+	captureLogs(t, slog.LevelInfo)
+
+	e := echo.New()
+	e.Use(Middleware())
+	var seen string
+	e.GET("/hello", func(c echo.Context) error {
+		seen = RequestID(c.Request().Context())
+		return nil
+	})
+
+	if rec := serve(e, "abc-123"); rec.Header().Get(echo.HeaderXRequestID) != "abc-123" || seen != "abc-123" {
+		t.Errorf("client request ID was not kept: header %q, context %q", rec.Header().Get(echo.HeaderXRequestID), seen)
+	}
+	if rec := serve(e, "bad id\n"); rec.Header().Get(echo.HeaderXRequestID) == "bad id\n" || seen == "bad id\n" {
+		t.Errorf("invalid request ID was accepted")
+	}
+}
+
+func TestRedactUnlessDebug(t *testing.T) {
+	ctx := context.Background()
+
+	captureLogs(t, slog.LevelInfo)
+	if got := Redact(ctx, "my prompt"); got != "[redacted 9 chars]" {
+		t.Errorf("got %q at info level", got)
+	}
+
+	SetLevel(slog.LevelDebug)
+	if got := Redact(ctx, "my prompt"); got != "my prompt" {
+		t.Errorf("got %q at debug level", got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if l, err := ParseLevel("WARN"); err != nil || l != slog.LevelWarn {
+		t.Errorf("got %v, %v", l, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// maxRequestIDLength bounds the IDs accepted from clients
+const maxRequestIDLength = 128
+
+// Middleware gives every request an ID, taken from the X-Request-ID header when the
+// client sends a usable one, returns it in the response and stores it in the request
+// context so the lines logged while serving it can be correlated. It then logs one line
+// per request; the query string is left out because it may carry a token.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = uuid.NewString()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			ctx := WithRequestID(req.Context(), id)
+			c.SetRequest(req.WithContext(ctx))
+
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// Let Echo write the error response so its status is logged
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			logLevel := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				logLevel = slog.LevelError
+			}
+			attrs := []any{
+				"method", req.Method,
+				"path", req.URL.Path,
+				"status", status,
+				"duration", time.Since(start),
+				"remote_ip", c.RealIP(),
+			}
+			if err != nil {
+				attrs = append(attrs, "error", err)
+			}
+			slog.Log(ctx, logLevel, "request", attrs...)
+
+			return nil
+		}
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
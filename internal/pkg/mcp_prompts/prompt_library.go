@@ -0,0 +1,126 @@
+package mcpprompts
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/usecase/prompt"
+)
+
+// PromptLibrary serves the prompts stored in the prompt library through prompts/list
+// and prompts/get, keeping the MCP server in sync with the database
+type PromptLibrary struct {
+	s        *server.MCPServer
+	promptUC *prompt.PromptUsecase
+	synced   map[string]time.Time
+}
+
+// NewPromptLibrary creates a prompt library bound to an MCP server
+func NewPromptLibrary(s *server.MCPServer, promptUC *prompt.PromptUsecase) *PromptLibrary {
+	return &PromptLibrary{s: s, promptUC: promptUC}
+}
+
+// Run syncs the prompts now and then every interval until ctx is cancelled
+func (l *PromptLibrary) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.Sync(ctx); err != nil {
+			slog.ErrorContext(ctx, "failed to sync prompt library", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync replaces the registered prompts when the library changed since the last sync.
+// Replacing them makes the server send notifications/prompts/list_changed.
+func (l *PromptLibrary) Sync(ctx context.Context) error {
+	prompts, err := l.promptUC.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]time.Time, len(prompts))
+	for _, p := range prompts {
+		current[p.Name] = p.UpdatedAt
+	}
+	if l.synced != nil && sameVersions(l.synced, current) {
+		return nil
+	}
+
+	entries := make([]server.ServerPrompt, 0, len(prompts))
+	for _, p := range prompts {
+		entries = append(entries, l.serverPrompt(p))
+	}
+	l.s.SetPrompts(entries...)
+	l.synced = current
+
+	return nil
+}
+
+// serverPrompt describes a library prompt for MCP clients
+func (l *PromptLibrary) serverPrompt(p dto.PromptTemplate) server.ServerPrompt {
+	opts := []mcp.PromptOption{mcp.WithPromptDescription(p.Description)}
+	for _, arg := range p.Arguments {
+		argOpts := []mcp.ArgumentOption{mcp.ArgumentDescription(arg.Description)}
+		if arg.Required {
+			argOpts = append(argOpts, mcp.RequiredArgument())
+		}
+		opts = append(opts, mcp.WithArgument(arg.Name, argOpts...))
+	}
+
+	name := p.Name
+	return server.ServerPrompt{
+		Prompt: mcp.NewPrompt(name, opts...),
+		Handler: func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			// Render the latest version, the template may have changed since the last sync
+			content, err := l.promptUC.Render(ctx, name, dto.PromptVariables{
+				Tools: l.toolNames(),
+				Args:  request.Params.Arguments,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to render prompt %s: %w", name, err)
+			}
+
+			return mcp.NewGetPromptResult(
+				p.Description,
+				[]mcp.PromptMessage{mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(content))},
+			), nil
+		},
+	}
+}
+
+// toolNames returns the tools served by the MCP server, for the {{.Tools}} variable
+func (l *PromptLibrary) toolNames() []string {
+	tools := l.s.ListTools()
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sameVersions(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, updated := range a {
+		if other, ok := b[name]; !ok || !other.Equal(updated) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package mcpresources
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxFileSize bounds what is returned when reading a file resource
+const maxFileSize = 1 << 20
+
+var ErrOutsideRoots = errors.New("path is outside the configured roots")
+
+// FileRoots gives read-only access to the files under a set of directories
+type FileRoots struct {
+	roots []string
+}
+
+// NewFileRoots creates file resources for the given directories
+func NewFileRoots(roots []string) (*FileRoots, error) {
+	f := &FileRoots{}
+	for _, r := range roots {
+		abs, err := filepath.Abs(r)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("file root %s is not a directory", r)
+		}
+		f.roots = append(f.roots, filepath.Clean(abs))
+	}
+	return f, nil
+}
+
+// Resources returns one resource per root; reading it lists the directory
+func (f *FileRoots) Resources() []server.ServerResource {
+	resources := make([]server.ServerResource, 0, len(f.roots))
+	for _, root := range f.roots {
+		resources = append(resources, server.ServerResource{
+			Resource: mcp.NewResource(
+				fileURI(root),
+				filepath.Base(root),
+				mcp.WithResourceDescription("Directory listing of "+root),
+				mcp.WithMIMEType("text/plain"),
+			),
+			Handler: f.read,
+		})
+	}
+	return resources
+}
+
+// Template returns the file:// template that reads any file under the roots
+func (f *FileRoots) Template() (template mcp.ResourceTemplate, handler server.ResourceTemplateHandlerFunc) {
+	return mcp.NewResourceTemplate(
+		"file://{+path}",
+		"Files",
+		mcp.WithTemplateDescription(fmt.Sprintf("Files and directories under: %s", strings.Join(f.roots, ", "))),
+	), f.read
+}
+
+// Version identifies the current state of a file:// resource, for subscriptions
+func (f *FileRoots) Version(uri string) (string, error) {
+	path, err := f.resolve(uri)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+func (f *FileRoots) read(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uri := request.Params.URI
+	path, err := f.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var listing strings.Builder
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() {
+				name += "/"
+			}
+			fmt.Fprintf(&listing, "%s\t%s\n", name, fileURI(filepath.Join(path, e.Name())))
+		}
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "text/plain", Text: listing.String()}}, nil
+	}
+
+	if info.Size() > maxFileSize {
+		return nil, fmt.Errorf("file %s is too large (%d bytes, max %d)", path, info.Size(), maxFileSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	if utf8.Valid(data) {
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: mimeType, Text: string(data)}}, nil
+	}
+	return []mcp.ResourceContents{mcp.BlobResourceContents{
+		URI:      uri,
+		MIMEType: mimeType,
+		Blob:     base64.StdEncoding.EncodeToString(data),
+	}}, nil
+}
+
+// resolve maps a file:// URI to a path, refusing anything outside the roots
+// (including symlinks that point out of them)
+func (f *FileRoots) resolve(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", fmt.Errorf("invalid file uri %q", uri)
+	}
+
+	path, err := filepath.EvalSymlinks(filepath.Clean(u.Path))
+	if err != nil {
+		return "", err
+	}
+
+	for _, root := range f.roots {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if path == realRoot || strings.HasPrefix(path, realRoot+string(filepath.Separator)) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrOutsideRoots, u.Path)
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,77 @@
+package mcpresources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// logTailSize is how much of the end of a log file is returned
+const logTailSize = 64 << 10
+
+// LogFile exposes the tail of a log file as log://<file name>
+func LogFile(path string) (resource mcp.Resource, handler server.ResourceHandlerFunc) {
+	uri := LogURI(path)
+	return mcp.NewResource(
+			uri,
+			filepath.Base(path),
+			mcp.WithResourceDescription(fmt.Sprintf("Last %d KB of %s", logTailSize>>10, path)),
+			mcp.WithMIMEType("text/plain"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			text, err := tail(path, logTailSize)
+			if err != nil {
+				return nil, err
+			}
+			return []mcp.ResourceContents{mcp.TextResourceContents{URI: uri, MIMEType: "text/plain", Text: text}}, nil
+		}
+}
+
+func LogURI(path string) string {
+	return "log://" + filepath.Base(path)
+}
+
+// LogVersion identifies the current state of a log file, for subscriptions
+func LogVersion(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+func tail(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > size {
+		if _, err := f.Seek(-size, io.SeekEnd); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > size {
+		// Start at a line boundary instead of in the middle of a line
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return string(data), nil
+}
@@ -0,0 +1,200 @@
+package mcpresources
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// VersionFunc returns a value that changes whenever the resource at uri changes
+type VersionFunc func(uri string) (string, error)
+
+// Subscriptions implements resources/subscribe and resources/unsubscribe, which the
+// MCP server library does not handle, and sends notifications/resources/updated when
+// a subscribed resource changes. Changes are detected by polling.
+type Subscriptions struct {
+	s        *server.MCPServer
+	interval time.Duration
+
+	mu       sync.Mutex
+	trackers map[string]VersionFunc // by URI prefix
+	versions map[string]string      // subscribed URI -> last seen version
+	out      io.Writer
+}
+
+// NewSubscriptions creates a subscription manager that polls every interval
+func NewSubscriptions(s *server.MCPServer, interval time.Duration) *Subscriptions {
+	return &Subscriptions{
+		s:        s,
+		interval: interval,
+		trackers: map[string]VersionFunc{},
+		versions: map[string]string{},
+	}
+}
+
+// Track registers how to detect changes of the resources whose URI starts with prefix
+func (m *Subscriptions) Track(prefix string, version VersionFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trackers[prefix] = version
+}
+
+// Intercept wraps the stdio streams of the server. Subscription requests are answered
+// here; everything else is passed through untouched.
+func (m *Subscriptions) Intercept(in io.Reader, out io.Writer) (io.Reader, io.Writer) {
+	w := &lockedWriter{w: out}
+	m.out = w
+
+	pr, pw := io.Pipe()
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 && !m.handle(line) {
+				if _, werr := pw.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return pr, w
+}
+
+// Run polls the subscribed resources until ctx is cancelled
+func (m *Subscriptions) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.poll()
+		}
+	}
+}
+
+func (m *Subscriptions) poll() {
+	m.mu.Lock()
+	var changed []string
+	for uri, last := range m.versions {
+		version, err := m.version(uri)
+		if err != nil || version == last {
+			continue
+		}
+		m.versions[uri] = version
+		changed = append(changed, uri)
+	}
+	m.mu.Unlock()
+
+	for _, uri := range changed {
+		m.s.SendNotificationToAllClients(mcp.MethodNotificationResourceUpdated, map[string]any{"uri": uri})
+	}
+}
+
+// handle answers subscription requests and reports whether the line was consumed
+func (m *Subscriptions) handle(line []byte) bool {
+	var request struct {
+		ID     any    `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			URI string `json:"uri"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(line, &request); err != nil || request.ID == nil {
+		return false
+	}
+
+	switch request.Method {
+	case "resources/subscribe":
+		m.mu.Lock()
+		version, err := m.version(request.Params.URI)
+		if err == nil {
+			m.versions[request.Params.URI] = version
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			m.reply(request.ID, err)
+		} else {
+			slog.Info("client subscribed to resource", "uri", request.Params.URI)
+			m.reply(request.ID, nil)
+		}
+		return true
+	case "resources/unsubscribe":
+		m.mu.Lock()
+		delete(m.versions, request.Params.URI)
+		m.mu.Unlock()
+
+		m.reply(request.ID, nil)
+		return true
+	default:
+		return false
+	}
+}
+
+// version must be called with m.mu held
+func (m *Subscriptions) version(uri string) (string, error) {
+	prefix := ""
+	for p := range m.trackers {
+		if strings.HasPrefix(uri, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return "", &unknownResourceError{uri}
+	}
+	return m.trackers[prefix](uri)
+}
+
+func (m *Subscriptions) reply(id any, err error) {
+	var response any
+	if err != nil {
+		response = mcp.NewJSONRPCError(mcp.NewRequestId(id), mcp.INVALID_PARAMS, err.Error(), nil)
+	} else {
+		response = mcp.NewJSONRPCResponse(mcp.NewRequestId(id), mcp.Result{})
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	if _, err := m.out.Write(append(b, '\n')); err != nil {
+		slog.Error("failed to write subscription response", "error", err)
+	}
+}
+
+type unknownResourceError struct {
+	uri string
+}
+
+func (e *unknownResourceError) Error() string {
+	return "resource does not support subscriptions: " + e.uri
+}
+
+// lockedWriter serializes writes so intercepted responses never interleave
+// with the ones written by the stdio server
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
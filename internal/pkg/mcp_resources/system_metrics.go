@@ -0,0 +1,37 @@
+package mcpresources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	systemmetrics "github.com/metalpoch/local-synapse/internal/infrastructure/system_metrics"
+)
+
+const SystemMetricsURI = "system://metrics"
+
+func SystemMetrics() (resource mcp.Resource, handler server.ResourceHandlerFunc) {
+	return mcp.NewResource(
+			SystemMetricsURI,
+			"System metrics",
+			mcp.WithResourceDescription("Current CPU, RAM, disk and network usage of the host"),
+			mcp.WithMIMEType("application/json"),
+		),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			metrics, err := systemmetrics.GetSystemMetrics()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get system metrics: %w", err)
+			}
+			b, err := json.MarshalIndent(metrics, "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			return []mcp.ResourceContents{mcp.TextResourceContents{
+				URI:      SystemMetricsURI,
+				MIMEType: "application/json",
+				Text:     string(b),
+			}}, nil
+		}
+}
@@ -0,0 +1,36 @@
+package mcptools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/metalpoch/local-synapse/internal/usecase/knowledge"
+)
+
+func KnowledgeSearch(knowledgeUC *knowledge.KnowledgeUsecase) (tool mcp.Tool, handler server.ToolHandlerFunc) {
+	return mcp.NewTool(
+			"knowledge-search",
+			mcp.WithDescription("Search the local knowledge base (ingested documents) and return the most relevant passages with their sources"),
+			mcp.WithString("query", mcp.Required(), mcp.Description("What to search for")),
+			mcp.WithNumber("top_k", mcp.Description(fmt.Sprintf("Number of passages to return (default %d)", knowledge.DefaultTopK))),
+		),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			query, err := request.RequireString("query")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			topK := request.GetInt("top_k", knowledge.DefaultTopK)
+
+			passages, err := knowledgeUC.Search(ctx, query, topK)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("failed to search knowledge base: %v", err)), nil
+			}
+			if len(passages) == 0 {
+				return mcp.NewToolResultText("No relevant passages found."), nil
+			}
+
+			return mcp.NewToolResultText(knowledge.FormatPassages(passages)), nil
+		}
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+)
+
+// Middleware starts a server span for every request, continuing the trace of the
+// caller when it sends a traceparent header. The span is named after the route, and
+// the trace ID is added to the log lines of the request.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := c.Path()
+			name := req.Method
+			if route != "" {
+				name += " " + route
+			}
+			ctx, span := Tracer().Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(req.URL.Path),
+					semconv.ClientAddress(c.RealIP()),
+				),
+			)
+			defer span.End()
+
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = logging.With(ctx, "trace_id", sc.TraceID().String())
+			}
+			c.SetRequest(req.WithContext(ctx))
+
+			if err := next(c); err != nil {
+				// Let Echo write the error response so its status is recorded
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+				span.SetAttributes(attribute.String("request_id", id))
+			}
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans makes a provider recording every span the global one for the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}
+
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	e := echo.New()
+	e.Use(Middleware())
+	var inside trace.SpanContext
+	e.GET("/items/:id", func(c echo.Context) error {
+		inside = trace.SpanContextFromContext(c.Request().Context())
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /items/:id" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("got span %q of kind %v", span.Name(), span.SpanKind())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("the caller's trace was not continued, got trace %s", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("got parent span %s", got)
+	}
+	if inside.SpanID() != span.SpanContext().SpanID() {
+		t.Error("the handler context does not carry the server span")
+	}
+	if got := attributeValue(span, "http.response.status_code").AsInt64(); got != http.StatusNoContent {
+		t.Errorf("got status attribute %d", got)
+	}
+}
+
+func TestMiddlewareMarksServerErrors(t *testing.T) {
+	recorder := recordSpans(t)
+
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/fail", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadGateway, "upstream down")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("got status %d", rec.Code)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Status().Code != codes.Error {
+		t.Fatalf("the failed request span is not marked as an error: %v", spans)
+	}
+}
+
+func TestInjectMap(t *testing.T) {
+	recordSpans(t)
+
+	ctx, span := Tracer().Start(context.Background(), "parent")
+	defer span.End()
+
+	fields := map[string]any{"request_id": "abc"}
+	InjectMap(ctx, fields)
+
+	traceparent, _ := fields["traceparent"].(string)
+	want := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+	if traceparent != want || fields["request_id"] != "abc" {
+		t.Errorf("got fields %v, want traceparent %s", fields, want)
+	}
+}
@@ -0,0 +1,17 @@
+package router
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/handler"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/pkg/auth"
+)
+
+func SetupAdminRouter(e *echo.Echo, ollamaPool *ollama_infra.Pool, ollamaQueue *ollama_infra.Queue, jwtSecret string) {
+	h := handler.NewAdminHandler(ollamaPool, ollamaQueue)
+
+	// Backend URLs and queue contents are internal details: admins only
+	router := e.Group("/api/v1/admin", auth.RequireRole(jwtSecret, auth.RoleAdmin))
+	router.GET("/backends", h.Backends)
+	router.GET("/queue", h.Queue)
+}
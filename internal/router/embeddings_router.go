@@ -0,0 +1,17 @@
+package router
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/handler"
+	"github.com/metalpoch/local-synapse/internal/pkg/auth"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+)
+
+func SetupEmbeddingsRouter(e *echo.Echo, embedUC *ollama.EmbedUsecase, jwtSecret string) {
+	h := handler.NewEmbeddingsHandler(embedUC)
+
+	e.POST("/api/v1/ollama/embeddings", h.Embed, auth.Optional(jwtSecret))
+
+	// OpenAI compatible endpoint so existing SDKs can point at this server
+	e.POST("/v1/embeddings", h.OpenAIEmbed, auth.Optional(jwtSecret))
+}
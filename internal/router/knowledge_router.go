@@ -0,0 +1,23 @@
+package router
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/metalpoch/local-synapse/internal/handler"
+	"github.com/metalpoch/local-synapse/internal/pkg/auth"
+	"github.com/metalpoch/local-synapse/internal/usecase/knowledge"
+)
+
+func SetupKnowledgeRouter(e *echo.Echo, knowledgeUC *knowledge.KnowledgeUsecase, jwtSecret string) {
+	h := handler.NewKnowledgeHandler(knowledgeUC)
+
+	router := e.Group("/api/v1/knowledge")
+	router.GET("/documents", h.List)
+	router.GET("/search", h.Search)
+
+	// The knowledge base is shared by every user, so only admins change it. Documents
+	// are up to 10 MiB; the limit leaves room for the JSON or multipart framing.
+	admin := router.Group("", auth.RequireRole(jwtSecret, auth.RoleAdmin))
+	admin.POST("/documents", h.Ingest, middleware.BodyLimit("11M"))
+	admin.DELETE("/documents/:id", h.Delete)
+}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/handler"
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/pkg/auth"
+	mcp_usecase "github.com/metalpoch/local-synapse/internal/usecase/mcp"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+)
+
+func SetupMCPRouter(e *echo.Echo, mcpClient mcpclient.MCPClient, toolCache *ollama.ToolCache, jwtSecret string) {
+	h := handler.NewMCPHandler(mcp_usecase.NewMCPUsecase(mcpClient, toolCache))
+
+	router := e.Group("/api/v1/mcp")
+	router.GET("/prompts", h.ListPrompts)
+	router.POST("/prompts/:name", h.GetPrompt)
+	router.GET("/resources", h.Resources)
+
+	// Introspection and direct tool calls are for debugging and need the admin role
+	admin := router.Group("", auth.RequireRole(jwtSecret, auth.RoleAdmin))
+	admin.GET("/servers", h.Servers)
+	admin.GET("/tools", h.Tools)
+	admin.POST("/tools/refresh", h.RefreshTools)
+	admin.POST("/tools/:name/call", h.CallTool)
+}
@@ -3,15 +3,29 @@ package router
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/metalpoch/local-synapse/internal/handler"
-	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/pkg/auth"
 	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
 )
 
-func SetupOllamaRouter(e *echo.Echo, ollamaUrl, model, systemPrompt string, mcpClient mcpclient.MCPClient) {
-	h := handler.NewOllamaHandler(
-		ollama.NewStreamChatUsecase(ollamaUrl, model, systemPrompt, mcpClient),
-	)
+func SetupOllamaRouter(
+	e *echo.Echo,
+	chatUC *ollama.StreamChatUsecase,
+	generateUC *ollama.GenerateUsecase,
+	modelsUC *ollama.ListModelsUsecase,
+	jwtSecret string,
+) {
+	h := handler.NewOllamaHandler(chatUC, generateUC, modelsUC)
 
-	router := e.Group("/api/v1/ollama")
+	router := e.Group("/api/v1/ollama", auth.Optional(jwtSecret))
 	router.GET("/chat", h.Stream)
+	router.POST("/chat", h.StreamConversation)
+	router.GET("/chat/:id", h.ChatStatus)
+	router.GET("/chat/:id/events", h.ResumeChat)
+	router.DELETE("/chat/:id", h.CancelChat)
+	router.POST("/chat/:id/approvals", h.ApproveTool)
+	router.POST("/generate", h.Generate)
+	router.GET("/models", h.Models)
+
+	// Browsers cannot set headers on a WebSocket, so the token may come in the URL
+	e.GET("/api/v1/ollama/ws", h.WebSocket, auth.TokenFromQuery("token"), auth.Optional(jwtSecret))
 }
@@ -0,0 +1,23 @@
+package router
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/metalpoch/local-synapse/internal/handler"
+	"github.com/metalpoch/local-synapse/internal/pkg/auth"
+	"github.com/metalpoch/local-synapse/internal/usecase/prompt"
+)
+
+func SetupPromptRouter(e *echo.Echo, promptUC *prompt.PromptUsecase, jwtSecret string) {
+	h := handler.NewPromptHandler(promptUC)
+
+	router := e.Group("/api/v1/prompts")
+	router.GET("", h.List)
+	router.GET("/:name", h.Get)
+	router.POST("/:name/render", h.Render)
+
+	// The library is shared by every user, so only admins change it
+	admin := router.Group("", auth.RequireRole(jwtSecret, auth.RoleAdmin))
+	admin.POST("", h.Create)
+	admin.PUT("/:name", h.Update)
+	admin.DELETE("/:name", h.Delete)
+}
@@ -0,0 +1,222 @@
+// Package testsupport provides in-process fakes of the services the API depends on,
+// so the whole chat flow can be exercised in tests without Ollama or an MCP binary.
+package testsupport
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+// ChatTurn scripts the answer to one /api/chat request
+type ChatTurn struct {
+	// Chunks are streamed in order, one NDJSON line each
+	Chunks []dto.OllamaChatResponse
+	// Delay is waited before every chunk
+	Delay time.Duration
+	// Status, when set, is answered instead of the chunks with Error as the body
+	Status int
+	// Error is sent as a mid-stream {"error": ...} line after the chunks
+	Error string
+	// Hang keeps the stream open after the chunks until the client goes away
+	Hang bool
+}
+
+// TextTurn answers with one chunk per part followed by a done chunk with token counts
+func TextTurn(parts ...string) ChatTurn {
+	var turn ChatTurn
+	for _, p := range parts {
+		var chunk dto.OllamaChatResponse
+		chunk.Message.Role = "assistant"
+		chunk.Message.Content = p
+		turn.Chunks = append(turn.Chunks, chunk)
+	}
+	turn.Chunks = append(turn.Chunks, doneChunk())
+	return turn
+}
+
+// ToolCallTurn answers with a single chunk requesting the given tool calls
+func ToolCallTurn(calls ...dto.ToolCall) ChatTurn {
+	var chunk dto.OllamaChatResponse
+	chunk.Message.Role = "assistant"
+	chunk.Message.ToolCalls = calls
+	return ChatTurn{Chunks: []dto.OllamaChatResponse{chunk, doneChunk()}}
+}
+
+// ToolCall builds a tool call for ToolCallTurn
+func ToolCall(name string, args map[string]any) dto.ToolCall {
+	return dto.ToolCall{Function: dto.ToolCallFunction{Name: name, Arguments: args}}
+}
+
+func doneChunk() dto.OllamaChatResponse {
+	var chunk dto.OllamaChatResponse
+	chunk.Message.Role = "assistant"
+	chunk.Done = true
+	chunk.DoneReason = "stop"
+	chunk.PromptEvalCount = 10
+	chunk.EvalCount = 5
+	return chunk
+}
+
+// FakeOllama is an HTTP server speaking the subset of the Ollama API used by the
+// application. Chat answers are taken from a script, one turn per request.
+type FakeOllama struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	turns    []ChatTurn
+	requests []dto.OllamaChatRequest
+	models   []dto.OllamaModel
+}
+
+// NewFakeOllama starts a fake Ollama server that is closed when the test ends
+func NewFakeOllama(t testing.TB) *FakeOllama {
+	t.Helper()
+
+	f := &FakeOllama{
+		models: []dto.OllamaModel{{Name: "test-model", Model: "test-model"}},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chat", f.chat)
+	mux.HandleFunc("GET /api/tags", f.tags)
+	mux.HandleFunc("GET /api/ps", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, dto.OllamaPsResponse{})
+	})
+	mux.HandleFunc("POST /api/embed", f.embed)
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// URL is the base URL to configure as the Ollama host
+func (f *FakeOllama) URL() string {
+	return f.server.URL
+}
+
+// ScriptChat queues the answers to the next chat requests
+func (f *FakeOllama) ScriptChat(turns ...ChatTurn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.turns = append(f.turns, turns...)
+}
+
+// SetModels replaces the models listed by /api/tags
+func (f *FakeOllama) SetModels(models ...dto.OllamaModel) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.models = models
+}
+
+// ChatRequests returns the chat requests received so far
+func (f *FakeOllama) ChatRequests() []dto.OllamaChatRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]dto.OllamaChatRequest(nil), f.requests...)
+}
+
+func (f *FakeOllama) chat(w http.ResponseWriter, r *http.Request) {
+	var request dto.OllamaChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, request)
+	if len(f.turns) == 0 {
+		f.mu.Unlock()
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "no scripted response"})
+		return
+	}
+	turn := f.turns[0]
+	f.turns = f.turns[1:]
+	f.mu.Unlock()
+
+	if turn.Status != 0 {
+		writeJSON(w, turn.Status, map[string]string{"error": turn.Error})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	for _, chunk := range turn.Chunks {
+		if turn.Delay > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(turn.Delay):
+			}
+		}
+		if !request.Stream {
+			// Non streaming requests get a single aggregated chunk below
+			continue
+		}
+		if err := enc.Encode(chunk); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if !request.Stream && len(turn.Chunks) > 0 {
+		final := turn.Chunks[len(turn.Chunks)-1]
+		var content strings.Builder
+		for _, chunk := range turn.Chunks {
+			content.WriteString(chunk.Message.Content)
+		}
+		final.Message.Content = content.String()
+		enc.Encode(final)
+	}
+
+	if turn.Error != "" {
+		enc.Encode(map[string]string{"error": turn.Error})
+		return
+	}
+
+	if turn.Hang {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		<-r.Context().Done()
+	}
+}
+
+func (f *FakeOllama) tags(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writeJSON(w, http.StatusOK, dto.OllamaTagsResponse{Models: f.models})
+}
+
+// embed answers with a small deterministic vector per input
+func (f *FakeOllama) embed(w http.ResponseWriter, r *http.Request) {
+	var request dto.OllamaEmbedRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	response := dto.OllamaEmbedResponse{Model: request.Model}
+	for _, input := range request.Input {
+		response.Embeddings = append(response.Embeddings, []float32{float32(len(input)), 1, 0})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,120 @@
+package testsupport
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+)
+
+// NewMCPServer returns an MCP server with tools meant for tests:
+//   - echo: returns its "text" argument
+//   - add: returns the sum of the numbers "a" and "b"
+//   - fail: always answers with a tool error
+//   - slow: blocks until the call is cancelled
+//   - request_id: returns the request ID sent in the call metadata
+//
+// a prompt, greeting, rendered as a user message greeting its "name" argument, and a
+// text resource, note://welcome.
+func NewMCPServer() *server.MCPServer {
+	s := server.NewMCPServer("testsupport", "0.0.1", server.WithToolCapabilities(true), server.WithPromptCapabilities(true),
+		server.WithResourceCapabilities(false, false))
+
+	s.AddResource(
+		mcp.NewResource("note://welcome", "welcome", mcp.WithMIMEType("text/plain")),
+		func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return []mcp.ResourceContents{mcp.TextResourceContents{URI: request.Params.URI, MIMEType: "text/plain", Text: "Welcome"}}, nil
+		},
+	)
+
+	s.AddPrompt(
+		mcp.NewPrompt("greeting", mcp.WithArgument("name", mcp.RequiredArgument())),
+		func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return mcp.NewGetPromptResult("Greeting", []mcp.PromptMessage{
+				mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("Hello, "+request.Params.Arguments["name"])),
+			}), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("echo",
+			mcp.WithDescription("Echo the given text"),
+			mcp.WithString("text", mcp.Required()),
+		),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			text, err := request.RequireString("text")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(text), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("add",
+			mcp.WithDescription("Add two numbers"),
+			mcp.WithNumber("a", mcp.Required()),
+			mcp.WithNumber("b", mcp.Required()),
+		),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			a, err := request.RequireFloat("a")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			b, err := request.RequireFloat("b")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(strconv.FormatFloat(a+b, 'f', -1, 64)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("fail", mcp.WithDescription("Always fails")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultError("something went wrong"), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("slow", mcp.WithDescription("Waits until the call is cancelled")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("request_id", mcp.WithDescription("Returns the request ID of the call")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var id string
+			if meta := request.Params.Meta; meta != nil {
+				id, _ = meta.AdditionalFields["request_id"].(string)
+			}
+			return mcp.NewToolResultText(id), nil
+		},
+	)
+
+	return s
+}
+
+// NewMCPClient connects an initialized client to s in-process. It is closed when the test ends.
+func NewMCPClient(t testing.TB, s *server.MCPServer) mcpclient.MCPClient {
+	t.Helper()
+
+	c, err := mcpclient.NewInProcessClient(s)
+	if err != nil {
+		t.Fatalf("creating in-process MCP client: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	if err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("initializing in-process MCP client: %v", err)
+	}
+
+	return c
+}
@@ -0,0 +1,80 @@
+package testsupport
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// SSEEvent is one event read from a text/event-stream body
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// SSEReader reads the events of a text/event-stream body one at a time, for tests that
+// act in the middle of a stream
+type SSEReader struct {
+	scanner *bufio.Scanner
+}
+
+// NewSSEReader creates a reader over a text/event-stream body
+func NewSSEReader(r io.Reader) *SSEReader {
+	return &SSEReader{scanner: bufio.NewScanner(r)}
+}
+
+// Next returns the next event, or io.EOF when the body ends. Multi-line data fields are
+// joined with newlines, as browsers do.
+func (r *SSEReader) Next() (SSEEvent, error) {
+	var current SSEEvent
+	var data []string
+	pending := false
+
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			if pending {
+				current.Data = strings.Join(data, "\n")
+				return current, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		pending = true
+		switch field {
+		case "id":
+			current.ID = value
+		case "event":
+			current.Event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return SSEEvent{}, err
+	}
+	return SSEEvent{}, io.EOF
+}
+
+// ReadSSE parses a text/event-stream body until it ends
+func ReadSSE(r io.Reader) ([]SSEEvent, error) {
+	var events []SSEEvent
+	reader := NewSSEReader(r)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
@@ -0,0 +1,154 @@
+package knowledge
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+const (
+	defaultChunkSize    = 1200
+	defaultChunkOverlap = 200
+)
+
+// chunker splits documents into overlapping passages small enough to embed,
+// keeping track of the page and Markdown section each passage came from
+type chunker struct {
+	size    int
+	overlap int
+	chunks  []dto.KnowledgeChunk
+}
+
+func newChunker() *chunker {
+	return &chunker{size: defaultChunkSize, overlap: defaultChunkOverlap}
+}
+
+// Split chunks content according to its format
+func (c *chunker) Split(format, content string) []dto.KnowledgeChunk {
+	c.chunks = nil
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	switch format {
+	case dto.DocumentFormatPDF:
+		// pdftotext separates pages with form feeds
+		for i, page := range strings.Split(content, "\f") {
+			c.splitBlock(page, i+1, "")
+		}
+	case dto.DocumentFormatMarkdown:
+		c.splitMarkdown(content)
+	default:
+		c.splitBlock(content, 0, "")
+	}
+
+	return c.chunks
+}
+
+// splitMarkdown starts a new passage at every heading so sections are not mixed
+func (c *chunker) splitMarkdown(content string) {
+	var section string
+	var block strings.Builder
+	inFence := false
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+
+		if !inFence && strings.HasPrefix(trimmed, "#") {
+			c.splitBlock(block.String(), 0, section)
+			block.Reset()
+			section = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		}
+
+		block.WriteString(line)
+		block.WriteByte('\n')
+	}
+
+	c.splitBlock(block.String(), 0, section)
+}
+
+// splitBlock packs paragraphs into passages of at most c.size characters
+func (c *chunker) splitBlock(text string, page int, section string) {
+	var current strings.Builder
+
+	flush := func() {
+		passage := strings.TrimSpace(current.String())
+		current.Reset()
+		if passage == "" {
+			return
+		}
+		c.chunks = append(c.chunks, dto.KnowledgeChunk{
+			Index:   len(c.chunks),
+			Content: passage,
+			Page:    page,
+			Section: section,
+		})
+		// Seed the next passage with the tail of this one to keep context across boundaries
+		current.WriteString(tail(passage, c.overlap))
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		for _, piece := range splitLong(paragraph, c.size-c.overlap) {
+			if current.Len() > 0 && current.Len()+len(piece)+2 > c.size {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			current.WriteString(piece)
+		}
+	}
+
+	// Do not emit a passage made only of the overlap seed
+	if passage := strings.TrimSpace(current.String()); passage != "" &&
+		(len(c.chunks) == 0 || !strings.HasSuffix(c.chunks[len(c.chunks)-1].Content, passage)) {
+		flush()
+	}
+}
+
+// splitLong breaks text longer than max characters at word boundaries
+func splitLong(text string, max int) []string {
+	if len(text) <= max {
+		return []string{text}
+	}
+
+	var pieces []string
+	var current strings.Builder
+	for _, word := range strings.Fields(text) {
+		if current.Len() > 0 && current.Len()+len(word)+1 > max {
+			pieces = append(pieces, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte(' ')
+		}
+		current.WriteString(word)
+	}
+	if current.Len() > 0 {
+		pieces = append(pieces, current.String())
+	}
+
+	return pieces
+}
+
+// tail returns roughly the last n characters of text, starting at a word boundary
+func tail(text string, n int) string {
+	if len(text) <= n {
+		return ""
+	}
+	t := text[len(text)-n:]
+	if i := strings.IndexAny(t, " \n"); i >= 0 {
+		return t[i+1:]
+	}
+	for len(t) > 0 && !utf8.RuneStart(t[0]) {
+		t = t[1:]
+	}
+	return t
+}
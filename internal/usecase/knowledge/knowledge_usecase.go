@@ -0,0 +1,163 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/llm"
+	vectorstore "github.com/metalpoch/local-synapse/internal/infrastructure/vector_store"
+)
+
+const (
+	DefaultTopK = 4
+	maxTopK     = 20
+
+	// embedBatchSize bounds how many chunks are sent to the provider per request
+	embedBatchSize = 32
+)
+
+var ErrInvalidDocument = errors.New("invalid document")
+
+// KnowledgeUsecase ingests documents into the vector store and retrieves relevant passages
+type KnowledgeUsecase struct {
+	llmProvider llm.Provider
+	store       *vectorstore.SQLiteStore
+	embedModel  string
+	minScore    float32
+}
+
+// NewKnowledgeUsecase creates a new knowledge usecase. Retrieve leaves out the passages
+// scoring below minScore.
+func NewKnowledgeUsecase(llmProvider llm.Provider, store *vectorstore.SQLiteStore, embedModel string, minScore float32) *KnowledgeUsecase {
+	return &KnowledgeUsecase{
+		llmProvider: llmProvider,
+		store:       store,
+		embedModel:  embedModel,
+		minScore:    minScore,
+	}
+}
+
+// Ingest chunks the document, embeds every chunk and stores the result
+func (uc *KnowledgeUsecase) Ingest(ctx context.Context, req dto.IngestDocumentRequest) (*dto.KnowledgeDocument, error) {
+	if strings.TrimSpace(req.Content) == "" {
+		return nil, fmt.Errorf("%w: content is empty", ErrInvalidDocument)
+	}
+	if strings.HasPrefix(req.Content, "%PDF-") {
+		return nil, fmt.Errorf("%w: send the text extracted from the PDF (e.g. with pdftotext), not the PDF file", ErrInvalidDocument)
+	}
+	if !utf8.ValidString(req.Content) {
+		return nil, fmt.Errorf("%w: content must be UTF-8 text", ErrInvalidDocument)
+	}
+
+	switch req.Format {
+	case "":
+		req.Format = dto.DocumentFormatText
+	case dto.DocumentFormatText, dto.DocumentFormatMarkdown, dto.DocumentFormatPDF:
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidDocument, req.Format)
+	}
+
+	if req.Title == "" {
+		req.Title = req.Source
+	}
+	if req.Title == "" {
+		return nil, fmt.Errorf("%w: title or source is required", ErrInvalidDocument)
+	}
+
+	chunks := newChunker().Split(req.Format, req.Content)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: no text to index", ErrInvalidDocument)
+	}
+
+	embeddings := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(chunks))
+
+		input := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			input = append(input, chunk.Content)
+		}
+
+		resp, err := uc.llmProvider.Embed(ctx, dto.OllamaEmbedRequest{Model: uc.embedModel, Input: input})
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed chunks: %w", err)
+		}
+		embeddings = append(embeddings, resp.Embeddings...)
+	}
+
+	return uc.store.AddDocument(ctx, dto.KnowledgeDocument{
+		Title:  req.Title,
+		Source: req.Source,
+		Format: req.Format,
+		Model:  uc.embedModel,
+	}, chunks, embeddings)
+}
+
+// ListDocuments returns all ingested documents
+func (uc *KnowledgeUsecase) ListDocuments(ctx context.Context) ([]dto.KnowledgeDocument, error) {
+	return uc.store.ListDocuments(ctx)
+}
+
+// DeleteDocument removes a document from the knowledge base
+func (uc *KnowledgeUsecase) DeleteDocument(ctx context.Context, id int64) error {
+	return uc.store.DeleteDocument(ctx, id)
+}
+
+// Search returns the top-k passages most relevant to query
+func (uc *KnowledgeUsecase) Search(ctx context.Context, query string, k int) ([]dto.KnowledgePassage, error) {
+	if strings.TrimSpace(query) == "" {
+		return []dto.KnowledgePassage{}, nil
+	}
+	if k <= 0 {
+		k = DefaultTopK
+	}
+	k = min(k, maxTopK)
+
+	resp, err := uc.llmProvider.Embed(ctx, dto.OllamaEmbedRequest{Model: uc.embedModel, Input: []string{query}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	return uc.store.Search(ctx, uc.embedModel, resp.Embeddings[0], k)
+}
+
+// Retrieve returns the top passages for query that score at least the minimum score,
+// the ones relevant enough to be given to the model
+func (uc *KnowledgeUsecase) Retrieve(ctx context.Context, query string) ([]dto.KnowledgePassage, error) {
+	passages, err := uc.Search(ctx, query, DefaultTopK)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(passages, func(p dto.KnowledgePassage) bool {
+		return p.Citation.Score < uc.minScore
+	}), nil
+}
+
+// FormatPassages renders passages as numbered, cited context for the model
+func FormatPassages(passages []dto.KnowledgePassage) string {
+	var b strings.Builder
+	for i, p := range passages {
+		fmt.Fprintf(&b, "[%d] %s\n%s\n\n", i+1, FormatCitation(p.Citation), p.Content)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// FormatCitation renders a human readable source reference
+func FormatCitation(c dto.Citation) string {
+	ref := c.Title
+	if c.Source != "" && c.Source != c.Title {
+		ref += " (" + c.Source + ")"
+	}
+	if c.Section != "" {
+		ref += " § " + c.Section
+	}
+	if c.Page > 0 {
+		ref += fmt.Sprintf(", p. %d", c.Page)
+	}
+	return ref
+}
@@ -0,0 +1,41 @@
+package knowledge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	vectorstore "github.com/metalpoch/local-synapse/internal/infrastructure/vector_store"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+)
+
+func TestRetrieveLeavesOutLowScores(t *testing.T) {
+	store, err := vectorstore.NewSQLiteStore(t.TempDir() + "/knowledge.db")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	// The fake embeds a text by its length, so "hi" matches the query exactly
+	fake := testsupport.NewFakeOllama(t)
+	uc := NewKnowledgeUsecase(ollama_infra.NewOllamaClient(fake.URL()), store, "test-embed", 0.95)
+	ctx := context.Background()
+	for _, content := range []string{"hi", strings.Repeat("a", 100)} {
+		if _, err := uc.Ingest(ctx, dto.IngestDocumentRequest{Title: content[:1], Content: content}); err != nil {
+			t.Fatalf("Ingest: %v", err)
+		}
+	}
+
+	if all, err := uc.Search(ctx, "hi", DefaultTopK); err != nil || len(all) != 2 {
+		t.Fatalf("Search: got %d passages, %v", len(all), err)
+	}
+	passages, err := uc.Retrieve(ctx, "hi")
+	if err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	if len(passages) != 1 || passages[0].Content != "hi" {
+		t.Errorf("got passages %+v", passages)
+	}
+}
@@ -0,0 +1,125 @@
+package mcp_usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/metalpoch/local-synapse/internal/dto"
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+	"github.com/metalpoch/local-synapse/internal/usecase/ollama"
+)
+
+var (
+	ErrMCPUnavailable = errors.New("mcp server is not available")
+	ErrToolNotFound   = errors.New("tool not found")
+)
+
+// MCPUsecase gives the API direct access to what the MCP server offers
+type MCPUsecase struct {
+	mcpClient mcpclient.MCPClient
+	toolCache *ollama.ToolCache
+}
+
+// NewMCPUsecase creates a new MCP usecase. mcpClient may be nil when the server failed to start.
+func NewMCPUsecase(mcpClient mcpclient.MCPClient, toolCache *ollama.ToolCache) *MCPUsecase {
+	return &MCPUsecase{mcpClient: mcpClient, toolCache: toolCache}
+}
+
+func (uc *MCPUsecase) ListPrompts(ctx context.Context) ([]mcp.Prompt, error) {
+	if uc.mcpClient == nil {
+		return nil, ErrMCPUnavailable
+	}
+	return uc.mcpClient.ListPrompts(ctx)
+}
+
+// GetPrompt renders a prompt on the MCP server, for previewing what a chat started from it would contain
+func (uc *MCPUsecase) GetPrompt(ctx context.Context, name string, args map[string]string) (*mcp.GetPromptResult, error) {
+	if uc.mcpClient == nil {
+		return nil, ErrMCPUnavailable
+	}
+	return uc.mcpClient.GetPrompt(ctx, name, args)
+}
+
+// ListResources returns the resources and resource templates a chat can attach as context
+func (uc *MCPUsecase) ListResources(ctx context.Context) ([]mcp.Resource, []mcp.ResourceTemplate, error) {
+	if uc.mcpClient == nil {
+		return nil, nil, ErrMCPUnavailable
+	}
+	return uc.mcpClient.ListResources(ctx)
+}
+
+// Servers reports the connection state of the MCP servers and what they declared on initialization
+func (uc *MCPUsecase) Servers(ctx context.Context) []dto.MCPServerStatus {
+	if uc.mcpClient == nil {
+		return []dto.MCPServerStatus{}
+	}
+
+	status := dto.MCPServerStatus{Connected: true}
+	if info := uc.mcpClient.ServerInfo(); info != nil {
+		status.Name = info.ServerInfo.Name
+		status.Version = info.ServerInfo.Version
+		status.ProtocolVersion = info.ProtocolVersion
+		status.Instructions = info.Instructions
+		status.Capabilities = info.Capabilities
+	} else {
+		status.Connected = false
+		status.Error = "session not initialized"
+	}
+
+	if status.Connected {
+		if err := uc.mcpClient.Ping(ctx); err != nil {
+			status.Connected = false
+			status.Error = err.Error()
+		} else if tools, err := uc.mcpClient.ListTools(ctx); err == nil {
+			status.Tools = len(tools)
+		}
+	}
+
+	return []dto.MCPServerStatus{status}
+}
+
+func (uc *MCPUsecase) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	if uc.mcpClient == nil {
+		return nil, ErrMCPUnavailable
+	}
+	return uc.mcpClient.ListTools(ctx)
+}
+
+// RefreshTools reloads the tool list offered to the model in chats and returns how many tools it has
+func (uc *MCPUsecase) RefreshTools(ctx context.Context) (int, error) {
+	if uc.mcpClient == nil {
+		return 0, ErrMCPUnavailable
+	}
+
+	tools, err := uc.toolCache.Refresh(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(tools), nil
+}
+
+// CallTool invokes a tool directly, bypassing the model
+func (uc *MCPUsecase) CallTool(ctx context.Context, name string, args map[string]any) (*mcp.CallToolResult, error) {
+	tools, err := uc.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, t := range tools {
+		if t.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+
+	slog.InfoContext(ctx, "direct call to MCP tool", "tool", name, "arguments", logging.Redact(ctx, fmt.Sprint(args)))
+	return uc.mcpClient.CallTool(ctx, name, args)
+}
@@ -0,0 +1,227 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/llm"
+)
+
+const (
+	ContextStrategySlidingWindow = "sliding-window"
+	ContextStrategySummarize     = "summarize"
+
+	// Rough token estimates; good enough to stay clear of the context limit
+	charsPerToken        = 4
+	messageOverhead      = 4
+	tokensPerImage       = 768
+	summaryPromptTokens  = 64
+	defaultContextTokens = 4096
+	defaultReserveTokens = 1024
+)
+
+var ErrContextOverflow = errors.New("conversation does not fit in the model context window")
+
+const summarizePrompt = "Summarize the following conversation between a user and an assistant. " +
+	"Keep facts, decisions, names, numbers and open questions; omit small talk. " +
+	"Answer only with the summary."
+
+// ContextPolicy controls how conversations are fitted into the model context window
+type ContextPolicy struct {
+	// MaxTokens is the model context window (Ollama's num_ctx)
+	MaxTokens int
+	// ReserveTokens is kept free for the model's answer
+	ReserveTokens int
+	// Strategy is either ContextStrategySlidingWindow or ContextStrategySummarize
+	Strategy string
+	// SetNumCtx sends MaxTokens to Ollama as num_ctx so both sides agree on the window
+	SetNumCtx bool
+}
+
+// ContextManager trims conversations so that requests always fit the context window.
+// System and pinned messages are never dropped; older turns are dropped whole (a user
+// message with the assistant answers and tool results that followed it) and, with the
+// summarize strategy, replaced by a summary written by the model.
+type ContextManager struct {
+	policy      ContextPolicy
+	llmProvider llm.Provider
+}
+
+// NewContextManager creates a new context manager
+func NewContextManager(policy ContextPolicy, llmProvider llm.Provider) *ContextManager {
+	if policy.MaxTokens <= 0 {
+		policy.MaxTokens = defaultContextTokens
+	}
+	if policy.ReserveTokens <= 0 || policy.ReserveTokens >= policy.MaxTokens {
+		policy.ReserveTokens = min(defaultReserveTokens, policy.MaxTokens/4)
+	}
+	if policy.Strategy == "" {
+		policy.Strategy = ContextStrategySlidingWindow
+	}
+
+	return &ContextManager{policy: policy, llmProvider: llmProvider}
+}
+
+// Options returns the model options the requests should carry
+func (m *ContextManager) Options() map[string]interface{} {
+	if !m.policy.SetNumCtx {
+		return nil
+	}
+	return map[string]interface{}{"num_ctx": m.policy.MaxTokens}
+}
+
+// Fit returns messages trimmed to the context budget. The last turn is always kept;
+// if it does not fit together with the system and pinned messages ErrContextOverflow
+// is returned instead of letting the server truncate the prompt silently.
+func (m *ContextManager) Fit(ctx context.Context, model string, messages []dto.OllamaChatMessage, tools []dto.Tool) ([]dto.OllamaChatMessage, error) {
+	budget := m.policy.MaxTokens - m.policy.ReserveTokens - EstimateToolTokens(tools)
+	if EstimateTokens(messages) <= budget {
+		return messages, nil
+	}
+
+	// Split into messages that must be kept and droppable turns
+	var kept []dto.OllamaChatMessage
+	var turns [][]dto.OllamaChatMessage
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "system" || msg.Pinned:
+			kept = append(kept, msg)
+		case msg.Role == "user" || len(turns) == 0:
+			turns = append(turns, []dto.OllamaChatMessage{msg})
+		default:
+			turns[len(turns)-1] = append(turns[len(turns)-1], msg)
+		}
+	}
+
+	used := EstimateTokens(kept)
+	if len(turns) > 0 {
+		used += EstimateTokens(turns[len(turns)-1])
+	}
+	if used > budget {
+		return nil, fmt.Errorf("%w: ~%d tokens needed, %d available", ErrContextOverflow, used, budget)
+	}
+
+	// Keep the most recent turns that fit, walking backwards
+	first := len(turns) - 1
+	for first > 0 && used+EstimateTokens(turns[first-1]) <= budget {
+		first--
+		used += EstimateTokens(turns[first])
+	}
+
+	var dropped []dto.OllamaChatMessage
+	for _, t := range turns[:first] {
+		dropped = append(dropped, t...)
+	}
+	slog.InfoContext(ctx, "dropping old messages to fit the context window", "dropped", len(dropped), "tokens_kept", used, "budget", budget)
+
+	var summary *dto.OllamaChatMessage
+	if m.policy.Strategy == ContextStrategySummarize && len(dropped) > 0 {
+		s, err := m.summarize(ctx, model, dropped)
+		if err != nil {
+			slog.WarnContext(ctx, "summarization failed, falling back to sliding window", "error", err)
+		} else if used+EstimateTokens([]dto.OllamaChatMessage{*s}) <= budget {
+			summary = s
+		}
+	}
+
+	result := make([]dto.OllamaChatMessage, 0, len(messages))
+	// System and pinned messages stay first, in their original order
+	result = append(result, kept...)
+	if summary != nil {
+		result = append(result, *summary)
+	}
+	for _, t := range turns[first:] {
+		result = append(result, t...)
+	}
+
+	return result, nil
+}
+
+// summarize asks the model for a compact summary of the dropped messages
+func (m *ContextManager) summarize(ctx context.Context, model string, dropped []dto.OllamaChatMessage) (*dto.OllamaChatMessage, error) {
+	var transcript strings.Builder
+	for _, msg := range dropped {
+		content := msg.Content
+		if msg.Role == "tool" && msg.ToolName != "" {
+			content = fmt.Sprintf("(%s) %s", msg.ToolName, content)
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, content)
+	}
+
+	// Keep the summarization request itself within the window
+	maxChars := (m.policy.MaxTokens - m.policy.ReserveTokens - summaryPromptTokens) * charsPerToken
+	if maxChars <= 0 {
+		return nil, errors.New("the context window leaves no room for a summarization request")
+	}
+	text := transcriptTail(transcript.String(), maxChars)
+
+	request := dto.OllamaChatRequest{
+		Model: model,
+		Messages: []dto.OllamaChatMessage{
+			{Role: "system", Content: summarizePrompt},
+			{Role: "user", Content: text},
+		},
+		Options: m.Options(),
+	}
+
+	var summary strings.Builder
+	err := m.llmProvider.StreamChatRequest(ctx, request, func(chunk dto.OllamaChatResponse) error {
+		summary.WriteString(chunk.Message.Content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(summary.String()) == "" {
+		return nil, errors.New("model returned an empty summary")
+	}
+
+	return &dto.OllamaChatMessage{
+		Role:    "system",
+		Content: "Summary of the earlier conversation:\n" + strings.TrimSpace(summary.String()),
+	}, nil
+}
+
+// transcriptTail returns the end of text that fits in maxBytes. It starts at a line
+// when possible and never in the middle of a UTF-8 character.
+func transcriptTail(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	cut := len(text) - maxBytes
+	if i := strings.IndexByte(text[cut:], '\n'); i >= 0 && cut+i+1 < len(text) {
+		return text[cut+i+1:]
+	}
+	for cut < len(text) && !utf8.RuneStart(text[cut]) {
+		cut++
+	}
+	return text[cut:]
+}
+
+// EstimateTokens approximates the number of tokens the messages take in the prompt
+func EstimateTokens(messages []dto.OllamaChatMessage) int {
+	total := 0
+	for _, msg := range messages {
+		total += messageOverhead + len(msg.Content)/charsPerToken + len(msg.Images)*tokensPerImage
+		for _, tc := range msg.ToolCalls {
+			args, _ := json.Marshal(tc.Function.Arguments)
+			total += (len(tc.Function.Name) + len(args)) / charsPerToken
+		}
+	}
+	return total
+}
+
+// EstimateToolTokens approximates the prompt space taken by tool definitions
+func EstimateToolTokens(tools []dto.Tool) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	b, _ := json.Marshal(tools)
+	return len(b) / charsPerToken
+}
@@ -0,0 +1,90 @@
+package ollama
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+)
+
+func newTestContextManager(fake *testsupport.FakeOllama, policy ContextPolicy) *ContextManager {
+	config := ollama_infra.DefaultClientConfig()
+	config.MaxRetries = 0
+	return NewContextManager(policy, ollama_infra.NewOllamaClientWithConfig(fake.URL(), config))
+}
+
+// conversation returns a system message, n turns of about 108 tokens and a short last question
+func conversation(n int) []dto.OllamaChatMessage {
+	messages := []dto.OllamaChatMessage{{Role: "system", Content: "sys"}}
+	for range n {
+		messages = append(messages,
+			dto.OllamaChatMessage{Role: "user", Content: strings.Repeat("q", 200)},
+			dto.OllamaChatMessage{Role: "assistant", Content: strings.Repeat("a", 200)},
+		)
+	}
+	return append(messages, dto.OllamaChatMessage{Role: "user", Content: "hi"})
+}
+
+func TestFitSummarizesDroppedTurns(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("the summary"))
+	manager := newTestContextManager(fake, ContextPolicy{MaxTokens: 400, ReserveTokens: 100, Strategy: ContextStrategySummarize})
+
+	messages, err := manager.Fit(context.Background(), "test-model", conversation(3), nil)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+
+	// system, summary, two kept turns and the question
+	if len(messages) != 7 {
+		t.Fatalf("got %d messages, want 7: %+v", len(messages), messages)
+	}
+	if messages[0].Content != "sys" || !strings.HasSuffix(messages[1].Content, "the summary") || messages[6].Content != "hi" {
+		t.Errorf("got %+v", messages)
+	}
+	if requests := fake.ChatRequests(); len(requests) != 1 {
+		t.Errorf("got %d summarization requests, want 1", len(requests))
+	}
+}
+
+func TestFitSummarizeWithoutRoomFallsBackToSlidingWindow(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	// num_ctx 80 leaves a reserve of 20: no room for the summarization prompt
+	manager := newTestContextManager(fake, ContextPolicy{MaxTokens: 80, Strategy: ContextStrategySummarize})
+
+	messages, err := manager.Fit(context.Background(), "test-model", conversation(1), nil)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Content != "sys" || messages[1].Content != "hi" {
+		t.Errorf("got %+v", messages)
+	}
+	if requests := fake.ChatRequests(); len(requests) != 0 {
+		t.Errorf("got %d summarization requests, want none", len(requests))
+	}
+}
+
+func TestTranscriptTail(t *testing.T) {
+	tests := []struct {
+		text     string
+		maxBytes int
+		want     string
+	}{
+		{"user: hola\n", 100, "user: hola\n"},
+		{"user: primera\nassistant: segunda\n", 20, "assistant: segunda\n"},
+		// A single long line is cut at a character boundary
+		{"user: canción\n", 3, "n\n"},
+		{"user: canción\n", 4, "ón\n"},
+		{"user: canción\n", 6, "ción\n"},
+	}
+	for _, tt := range tests {
+		got := transcriptTail(tt.text, tt.maxBytes)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("transcriptTail(%q, %d) = %q, want %q", tt.text, tt.maxBytes, got, tt.want)
+		}
+	}
+}
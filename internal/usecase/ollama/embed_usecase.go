@@ -0,0 +1,125 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/llm"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+)
+
+// embedBatchSize bounds how many inputs are sent to the provider per request
+const embedBatchSize = 64
+
+var (
+	ErrModelNotAllowed = errors.New("model is not allowed")
+	ErrInvalidInput    = errors.New("invalid input")
+)
+
+// EmbedUsecase proxies embedding requests to the LLM provider for an allow-listed set of models
+type EmbedUsecase struct {
+	llmProvider  llm.Provider
+	defaultModel string
+
+	mu            sync.RWMutex
+	allowedModels map[string]bool
+	maxInputs     int
+}
+
+// NewEmbedUsecase creates a new embed usecase. defaultModel is used when a request
+// does not name a model and is always allowed; maxInputs of zero means no limit.
+func NewEmbedUsecase(llmProvider llm.Provider, defaultModel string, allowedModels []string, maxInputs int) *EmbedUsecase {
+	uc := &EmbedUsecase{
+		llmProvider:  llmProvider,
+		defaultModel: defaultModel,
+	}
+	uc.Reconfigure(allowedModels, maxInputs)
+	return uc
+}
+
+// Reconfigure replaces the model allow-list and the maximum number of inputs per request
+func (uc *EmbedUsecase) Reconfigure(allowedModels []string, maxInputs int) {
+	allowed := make(map[string]bool, len(allowedModels)+1)
+	for _, m := range allowedModels {
+		allowed[m] = true
+	}
+	if uc.defaultModel != "" {
+		allowed[uc.defaultModel] = true
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.allowedModels = allowed
+	uc.maxInputs = maxInputs
+}
+
+// Execute embeds every input, splitting large requests into batches
+func (uc *EmbedUsecase) Execute(ctx context.Context, req dto.EmbeddingsRequest) (*dto.OllamaEmbedResponse, error) {
+	if req.Model == "" {
+		req.Model = uc.defaultModel
+	}
+	uc.mu.RLock()
+	allowed, maxInputs := uc.allowedModels[req.Model], uc.maxInputs
+	uc.mu.RUnlock()
+
+	if !allowed {
+		return nil, fmt.Errorf("%w: %q", ErrModelNotAllowed, req.Model)
+	}
+
+	if len(req.Input) == 0 {
+		return nil, fmt.Errorf("%w: input is empty", ErrInvalidInput)
+	}
+	if maxInputs > 0 && len(req.Input) > maxInputs {
+		return nil, fmt.Errorf("%w: at most %d inputs per request", ErrInvalidInput, maxInputs)
+	}
+
+	// The Ollama queue takes turns between users
+	if req.Caller != nil {
+		ctx = ollama_infra.WithRequester(ctx, ollama_infra.Requester{User: req.Caller.User, Role: req.Caller.Role})
+	}
+
+	result := &dto.OllamaEmbedResponse{
+		Model:      req.Model,
+		Embeddings: make([][]float32, 0, len(req.Input)),
+	}
+
+	for start := 0; start < len(req.Input); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(req.Input))
+
+		resp, err := uc.llmProvider.Embed(ctx, dto.OllamaEmbedRequest{
+			Model:      req.Model,
+			Input:      req.Input[start:end],
+			Truncate:   req.Truncate,
+			Dimensions: req.Dimensions,
+			KeepAlive:  req.KeepAlive,
+			Options:    req.Options,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result.Embeddings = append(result.Embeddings, resp.Embeddings...)
+		result.TotalDuration += resp.TotalDuration
+		result.LoadDuration += resp.LoadDuration
+		result.PromptEvalCount += resp.PromptEvalCount
+	}
+
+	var caller dto.Caller
+	if req.Caller != nil {
+		caller = *req.Caller
+	}
+	slog.InfoContext(ctx, "embeddings served",
+		"model", req.Model,
+		"inputs", len(req.Input),
+		"prompt_tokens", result.PromptEvalCount,
+		"user", caller.User,
+		"role", caller.Role,
+		"address", caller.Address,
+	)
+
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package ollama
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+)
+
+// eventEmitter assigns sequential IDs to stream events before handing them to the caller
+type eventEmitter struct {
+	seq     int64
+	onEvent func(dto.StreamEvent) error
+}
+
+func newEventEmitter(onEvent func(dto.StreamEvent) error) *eventEmitter {
+	return &eventEmitter{onEvent: onEvent}
+}
+
+func (e *eventEmitter) emit(eventType dto.StreamEventType, data interface{}) error {
+	e.seq++
+	return e.onEvent(dto.StreamEvent{
+		ID:   e.seq,
+		Type: eventType,
+		Data: data,
+	})
+}
+
+// emitChunk translates a raw Ollama chunk into token and thinking events
+func (e *eventEmitter) emitChunk(chunk dto.OllamaChatResponse) error {
+	if chunk.Message.Thinking != "" {
+		if err := e.emit(dto.StreamEventThinking, dto.TokenEventData{Content: chunk.Message.Thinking}); err != nil {
+			return err
+		}
+	}
+	if chunk.Message.Content != "" {
+		if err := e.emit(dto.StreamEventToken, dto.TokenEventData{Content: chunk.Message.Content}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errorEventData describes a failure for an error event
+func errorEventData(err error) dto.ErrorEventData {
+	data := dto.ErrorEventData{Message: err.Error()}
+	if errors.Is(err, ollama_infra.ErrQueueFull) || errors.Is(err, ollama_infra.ErrQueueTimeout) {
+		data.Code = http.StatusServiceUnavailable
+	}
+	return data
+}
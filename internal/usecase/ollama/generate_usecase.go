@@ -0,0 +1,97 @@
+package ollama
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+)
+
+// GenerateUsecase streams raw completions from Ollama's /api/generate endpoint
+type GenerateUsecase struct {
+	ollamaClient ollama_infra.Client
+	model        string
+}
+
+// NewGenerateUsecase creates a new generate usecase
+func NewGenerateUsecase(ollamaClient ollama_infra.Client, model string) *GenerateUsecase {
+	return &GenerateUsecase{
+		ollamaClient: ollamaClient,
+		model:        model,
+	}
+}
+
+// Execute streams a completion for the request, reporting progress to onEvent with
+// the same typed events used by the chat stream
+func (uc *GenerateUsecase) Execute(ctx context.Context, request dto.OllamaGenerateRequest, onEvent func(dto.StreamEvent) error) error {
+	emitter := newEventEmitter(onEvent)
+
+	if err := uc.run(ctx, request, emitter); err != nil {
+		if ctx.Err() == nil {
+			// Best effort: the client may already be gone
+			_ = emitter.emit(dto.StreamEventError, errorEventData(err))
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (uc *GenerateUsecase) run(ctx context.Context, request dto.OllamaGenerateRequest, emitter *eventEmitter) error {
+	if request.Prompt == "" && request.Suffix == "" {
+		return fmt.Errorf("prompt is required")
+	}
+	if request.Model == "" {
+		request.Model = uc.model
+	}
+
+	slog.InfoContext(ctx, "sending generate request",
+		"model", request.Model,
+		"raw", request.Raw,
+		"prompt", logging.Redact(ctx, request.Prompt),
+	)
+
+	var content string
+	var last dto.OllamaGenerateResponse
+
+	err := uc.ollamaClient.StreamGenerate(ctx, request, func(chunk dto.OllamaGenerateResponse) error {
+		content += chunk.Response
+		if chunk.Done {
+			last = chunk
+		}
+
+		if chunk.Thinking != "" {
+			if err := emitter.emit(dto.StreamEventThinking, dto.TokenEventData{Content: chunk.Thinking}); err != nil {
+				return err
+			}
+		}
+		if chunk.Response != "" {
+			return emitter.emit(dto.StreamEventToken, dto.TokenEventData{Content: chunk.Response})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := emitter.emit(dto.StreamEventUsage, dto.UsageEventData{
+		PromptTokens:     last.PromptEvalCount,
+		CompletionTokens: last.EvalCount,
+		TotalTokens:      last.PromptEvalCount + last.EvalCount,
+		TotalDuration:    last.TotalDuration,
+		LoadDuration:     last.LoadDuration,
+		EvalDuration:     last.EvalDuration,
+	}); err != nil {
+		return err
+	}
+
+	// The returned context lets clients continue the completion in a follow-up request
+	return emitter.emit(dto.StreamEventDone, dto.DoneEventData{
+		Content:    content,
+		DoneReason: last.DoneReason,
+		Context:    last.Context,
+	})
+}
@@ -0,0 +1,439 @@
+package ollama
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+)
+
+const (
+	// DefaultGenerationRetention is how long finished generations can still be looked up and replayed
+	DefaultGenerationRetention = 10 * time.Minute
+	// resumeWindow is how long a detached generation keeps running with nobody following it
+	resumeWindow = 30 * time.Second
+	// approvalTimeout is how long a tool call waits for approval before it is denied
+	approvalTimeout = 5 * time.Minute
+)
+
+var (
+	ErrGenerationNotFound  = errors.New("generation not found")
+	ErrGenerationForbidden = errors.New("generation belongs to another user")
+	ErrGenerationFinished  = errors.New("generation already finished")
+	ErrApprovalNotPending  = errors.New("tool call is not awaiting approval")
+	// ErrGenerationCancelled is the cause of the context of a generation cancelled explicitly
+	ErrGenerationCancelled = errors.New("generation cancelled")
+)
+
+// generation is a chat being generated, or recently finished. Its events are buffered
+// so clients that lose the connection can replay what they missed.
+type generation struct {
+	mu         sync.Mutex
+	id         string
+	model      string
+	caller     *dto.Caller
+	status     dto.GenerationState
+	err        error
+	content    strings.Builder
+	startedAt  time.Time
+	finishedAt time.Time
+	cancel     context.CancelCauseFunc
+	// logCtx carries the request and generation IDs into the lines logged about it
+	logCtx context.Context
+
+	events []dto.StreamEvent
+	// approvals holds the decision channel of each tool call awaiting approval
+	approvals map[string]chan bool
+	// updated is closed and replaced whenever an event is published or the generation finishes
+	updated chan struct{}
+
+	// detached generations are not tied to a connection; they are abandoned
+	// once nobody has followed them for resumeWindow
+	detached  bool
+	followers int
+	abandon   *time.Timer
+	window    time.Duration
+
+	// forget removes the generation from the registry once retention has passed after
+	// it finished, releasing its buffered events
+	forget    func()
+	retention time.Duration
+}
+
+// publish buffers an event and wakes up the followers
+func (g *generation) publish(event dto.StreamEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.events = append(g.events, event)
+	close(g.updated)
+	g.updated = make(chan struct{})
+}
+
+// eventsAfter returns the buffered events with an ID greater than after, whether the
+// generation has finished, and a channel closed on the next change
+func (g *generation) eventsAfter(after int64) ([]dto.StreamEvent, bool, <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// IDs grow but may have gaps once the generation is compacted
+	start, _ := slices.BinarySearchFunc(g.events, after+1, func(e dto.StreamEvent, id int64) int {
+		return cmp.Compare(e.ID, id)
+	})
+	events := append([]dto.StreamEvent(nil), g.events[start:]...)
+	return events, g.status != dto.GenerationRunning, g.updated
+}
+
+// compactLocked merges each run of token events of a finished generation nobody is
+// following into a single event carrying the ID of the last one, so a replay still
+// returns the whole answer without keeping one event per token.
+func (g *generation) compactLocked() {
+	if g.status == dto.GenerationRunning || g.followers > 0 {
+		return
+	}
+	compacted := g.events[:0]
+	var text strings.Builder
+	for i, event := range g.events {
+		data, ok := event.Data.(dto.TokenEventData)
+		if event.Type != dto.StreamEventToken || !ok {
+			compacted = append(compacted, event)
+			continue
+		}
+		text.WriteString(data.Content)
+		if i+1 < len(g.events) && g.events[i+1].Type == dto.StreamEventToken {
+			continue
+		}
+		event.Data = dto.TokenEventData{Content: text.String()}
+		compacted = append(compacted, event)
+		text.Reset()
+	}
+	g.events = slices.Clip(compacted)
+}
+
+// awaitApprovals waits for the client to decide on each tool call. Calls without a
+// decision within approvalTimeout are denied.
+func (g *generation) awaitApprovals(ctx context.Context, callIDs []string) (map[string]bool, error) {
+	pending := make(map[string]chan bool, len(callIDs))
+	g.mu.Lock()
+	if g.approvals == nil {
+		g.approvals = map[string]chan bool{}
+	}
+	for _, id := range callIDs {
+		pending[id] = make(chan bool, 1)
+		g.approvals[id] = pending[id]
+	}
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for _, id := range callIDs {
+			delete(g.approvals, id)
+		}
+	}()
+
+	timeout := time.NewTimer(approvalTimeout)
+	defer timeout.Stop()
+
+	decisions := make(map[string]bool, len(callIDs))
+	for _, id := range callIDs {
+		select {
+		case approved := <-pending[id]:
+			decisions[id] = approved
+		case <-timeout.C:
+			slog.WarnContext(ctx, "no decision on tool call, denying it", "call_id", id)
+			decisions[id] = false
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return decisions, nil
+}
+
+func (g *generation) decide(callID string, approved bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	decision, ok := g.approvals[callID]
+	if !ok {
+		return ErrApprovalNotPending
+	}
+	delete(g.approvals, callID)
+	decision <- approved
+	return nil
+}
+
+func (g *generation) attach() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.followers++
+	if g.abandon != nil {
+		g.abandon.Stop()
+		g.abandon = nil
+	}
+}
+
+// detach starts the resume window when the last follower of a detached generation leaves
+func (g *generation) detach() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.followers--
+	g.compactLocked()
+	if g.followers > 0 || !g.detached || g.status != dto.GenerationRunning {
+		return
+	}
+	g.abandon = time.AfterFunc(g.window, func() {
+		slog.InfoContext(g.logCtx, "generation abandoned: no client reconnected")
+		g.cancel(nil)
+	})
+}
+
+// appendContent records streamed answer text so the partial answer survives a cancellation
+func (g *generation) appendContent(s string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.content.WriteString(s)
+}
+
+func (g *generation) partialContent() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.content.String()
+}
+
+func (g *generation) finish(status dto.GenerationState) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.status = status
+	g.finishedAt = time.Now()
+	if g.abandon != nil {
+		g.abandon.Stop()
+		g.abandon = nil
+	}
+	if g.forget != nil {
+		time.AfterFunc(g.retention, g.forget)
+	}
+	g.compactLocked()
+	close(g.updated)
+	g.updated = make(chan struct{})
+}
+
+// fail finishes the generation with the error that stopped it
+func (g *generation) fail(err error) {
+	g.mu.Lock()
+	g.err = err
+	g.mu.Unlock()
+	g.finish(dto.GenerationFailed)
+}
+
+func (g *generation) info() dto.GenerationStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	info := dto.GenerationStatus{
+		ID:        g.id,
+		Model:     g.model,
+		Status:    g.status,
+		Content:   g.content.String(),
+		StartedAt: g.startedAt,
+	}
+	if g.caller != nil {
+		info.User = g.caller.User
+	}
+	if !g.finishedAt.IsZero() {
+		finishedAt := g.finishedAt
+		info.FinishedAt = &finishedAt
+	}
+	return info
+}
+
+// ownedBy reports whether caller may look at or cancel the generation. Generations
+// started without a user belong to the client address that started them.
+func (g *generation) ownedBy(caller *dto.Caller) bool {
+	if g.caller == nil {
+		return true
+	}
+	if caller == nil {
+		return false
+	}
+	if g.caller.User == "" {
+		return caller.User == "" && caller.Address == g.caller.Address
+	}
+	return caller.User == g.caller.User
+}
+
+// GenerationRegistry keeps track of running generations so they can be cancelled from
+// another connection, and remembers finished ones for a while
+type GenerationRegistry struct {
+	mu           sync.Mutex
+	generations  map[string]*generation
+	resumeWindow time.Duration
+	retention    time.Duration
+}
+
+// NewGenerationRegistry creates an empty registry
+func NewGenerationRegistry() *GenerationRegistry {
+	return &GenerationRegistry{
+		generations:  map[string]*generation{},
+		resumeWindow: resumeWindow,
+		retention:    DefaultGenerationRetention,
+	}
+}
+
+// SetRetention changes how long the generations finishing from now on are kept
+func (r *GenerationRegistry) SetRetention(retention time.Duration) {
+	if retention <= 0 {
+		retention = DefaultGenerationRetention
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retention = retention
+}
+
+// start registers a new generation and returns it with the context it must run under
+func (r *GenerationRegistry) start(ctx context.Context, model string, caller *dto.Caller, detached bool) (*generation, context.Context) {
+	id := uuid.NewString()
+	ctx, cancel := context.WithCancelCause(logging.With(ctx, "generation_id", id))
+	g := &generation{
+		id:        id,
+		model:     model,
+		caller:    caller,
+		status:    dto.GenerationRunning,
+		startedAt: time.Now(),
+		cancel:    cancel,
+		logCtx:    context.WithoutCancel(ctx),
+		updated:   make(chan struct{}),
+		detached:  detached,
+		window:    r.resumeWindow,
+	}
+	g.forget = func() { r.forget(id) }
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g.retention = r.retention
+	r.generations[g.id] = g
+
+	return g, ctx
+}
+
+// Cancel aborts a running generation. Admins may cancel any generation.
+func (r *GenerationRegistry) Cancel(id string, caller *dto.Caller, admin bool) error {
+	g, err := r.lookup(id, caller, admin)
+	if err != nil {
+		return err
+	}
+	if g.info().Status != dto.GenerationRunning {
+		return ErrGenerationFinished
+	}
+	g.cancel(ErrGenerationCancelled)
+	return nil
+}
+
+// Approve records the client's decision on a tool call awaiting approval
+func (r *GenerationRegistry) Approve(id, callID string, approved bool, caller *dto.Caller, admin bool) error {
+	g, err := r.lookup(id, caller, admin)
+	if err != nil {
+		return err
+	}
+	return g.decide(callID, approved)
+}
+
+// Status returns the state of a running or recently finished generation
+func (r *GenerationRegistry) Status(id string, caller *dto.Caller, admin bool) (*dto.GenerationStatus, error) {
+	g, err := r.lookup(id, caller, admin)
+	if err != nil {
+		return nil, err
+	}
+	info := g.info()
+	return &info, nil
+}
+
+// Subscribe attaches a follower to a generation, so a detached generation keeps running
+// while someone is reading it. Stream must be called on the result.
+func (r *GenerationRegistry) Subscribe(id string, caller *dto.Caller, admin bool) (*Subscription, error) {
+	g, err := r.lookup(id, caller, admin)
+	if err != nil {
+		return nil, err
+	}
+	g.attach()
+	return &Subscription{gen: g}, nil
+}
+
+// CancelAll aborts every running generation, for shutdown
+func (r *GenerationRegistry) CancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range r.generations {
+		g.cancel(nil)
+	}
+}
+
+func (r *GenerationRegistry) lookup(id string, caller *dto.Caller, admin bool) (*generation, error) {
+	r.mu.Lock()
+	g, ok := r.generations[id]
+	r.mu.Unlock()
+
+	if !ok {
+		return nil, ErrGenerationNotFound
+	}
+	if !admin && !g.ownedBy(caller) {
+		return nil, ErrGenerationForbidden
+	}
+	return g, nil
+}
+
+func (r *GenerationRegistry) forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.generations, id)
+}
+
+// Subscription follows the events of one generation
+type Subscription struct {
+	gen *generation
+}
+
+// GenerationID returns the ID of the generation being followed
+func (s *Subscription) GenerationID() string {
+	return s.gen.id
+}
+
+// Err returns the error a failed generation stopped with
+func (s *Subscription) Err() error {
+	s.gen.mu.Lock()
+	defer s.gen.mu.Unlock()
+	return s.gen.err
+}
+
+// Stream replays the buffered events with an ID greater than after and then follows the
+// live generation until it finishes, ctx is done or onEvent fails. Leaving early does
+// not stop the generation; it can be resumed from the last event delivered.
+func (s *Subscription) Stream(ctx context.Context, after int64, onEvent func(dto.StreamEvent) error) error {
+	defer s.gen.detach()
+
+	for {
+		events, finished, updated := s.gen.eventsAfter(after)
+		for _, event := range events {
+			if err := onEvent(event); err != nil {
+				return err
+			}
+			after = event.ID
+		}
+		if finished {
+			return nil
+		}
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
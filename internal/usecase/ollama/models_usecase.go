@@ -0,0 +1,22 @@
+package ollama
+
+import (
+	"context"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/llm"
+)
+
+// ListModelsUsecase lists the models offered by every configured provider
+type ListModelsUsecase struct {
+	llmProvider llm.Provider
+}
+
+// NewListModelsUsecase creates a new list models usecase
+func NewListModelsUsecase(llmProvider llm.Provider) *ListModelsUsecase {
+	return &ListModelsUsecase{llmProvider: llmProvider}
+}
+
+func (uc *ListModelsUsecase) Execute(ctx context.Context) ([]dto.OllamaModel, error) {
+	return uc.llmProvider.ListModels(ctx)
+}
@@ -2,108 +2,379 @@ package ollama
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/llm"
 	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
 	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
+	"github.com/metalpoch/local-synapse/internal/usecase/knowledge"
+	"github.com/metalpoch/local-synapse/internal/usecase/prompt"
 )
 
-// StreamChatUsecase orchestrates the chat streaming flow with Ollama
+// agentName identifies the chat agent in the traces
+const agentName = "local-synapse"
+
+var (
+	ErrPromptLibraryDisabled = errors.New("prompt library is not enabled")
+	ErrMCPUnavailable        = errors.New("mcp server is not available")
+	ErrRequestTooLarge       = errors.New("request is too large")
+)
+
+// ChatLimits bounds the size of chat requests. Zero disables a limit.
+type ChatLimits struct {
+	MaxPromptChars     int
+	MaxHistoryMessages int
+}
+
+// chatSettings are the settings that can change while the server runs. Each
+// conversation takes a snapshot when it starts, so a reload never affects it midway.
+type chatSettings struct {
+	systemPrompt string
+	toolPolicies dto.ToolPolicies
+	limits       ChatLimits
+}
+
+// StreamChatUsecase orchestrates the chat streaming flow with the LLM provider
 type StreamChatUsecase struct {
-	ollamaClient *ollama_infra.OllamaClient
+	llmProvider  llm.Provider
 	toolExecutor *ToolExecutor
 	mcpClient    mcpclient.MCPClient
+	toolCache    *ToolCache
+	knowledgeUC  *knowledge.KnowledgeUsecase
+	promptUC     *prompt.PromptUsecase
+	contextMgr   *ContextManager
+	generations  *GenerationRegistry
 	model        string
-	systemPrompt string
+
+	mu       sync.RWMutex
+	settings chatSettings
 }
 
 // NewStreamChatUsecase creates a new stream chat usecase
 func NewStreamChatUsecase(
-	ollamaURL string,
+	llmProvider llm.Provider,
 	model string,
 	systemPrompt string,
 	mcpClient mcpclient.MCPClient,
+	toolCache *ToolCache,
+	knowledgeUC *knowledge.KnowledgeUsecase,
+	promptUC *prompt.PromptUsecase,
+	contextPolicy ContextPolicy,
+	toolPolicies dto.ToolPolicies,
+	limits ChatLimits,
 ) *StreamChatUsecase {
 	return &StreamChatUsecase{
-		ollamaClient: ollama_infra.NewOllamaClient(ollamaURL),
+		llmProvider:  llmProvider,
 		toolExecutor: NewToolExecutor(mcpClient),
 		mcpClient:    mcpClient,
+		toolCache:    toolCache,
+		knowledgeUC:  knowledgeUC,
+		promptUC:     promptUC,
+		contextMgr:   NewContextManager(contextPolicy, llmProvider),
+		generations:  NewGenerationRegistry(),
 		model:        model,
+		settings: chatSettings{
+			systemPrompt: systemPrompt,
+			toolPolicies: toolPolicies,
+			limits:       limits,
+		},
+	}
+}
+
+// Reconfigure replaces the default system prompt, the tool policies and the limits.
+// Conversations already streaming keep the settings they started with.
+func (uc *StreamChatUsecase) Reconfigure(systemPrompt string, toolPolicies dto.ToolPolicies, limits ChatLimits) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.settings = chatSettings{
 		systemPrompt: systemPrompt,
+		toolPolicies: toolPolicies,
+		limits:       limits,
 	}
 }
 
+func (uc *StreamChatUsecase) currentSettings() chatSettings {
+	uc.mu.RLock()
+	defer uc.mu.RUnlock()
+	return uc.settings
+}
+
+// Validate checks the parts of a chat request that must be resolved before streaming starts
+func (uc *StreamChatUsecase) Validate(ctx context.Context, chat dto.ChatRequest) error {
+	limits := uc.currentSettings().limits
+	if limits.MaxPromptChars > 0 && utf8.RuneCountInString(chat.Prompt) > limits.MaxPromptChars {
+		return fmt.Errorf("%w: prompt is longer than %d characters", ErrRequestTooLarge, limits.MaxPromptChars)
+	}
+	if limits.MaxHistoryMessages > 0 && len(chat.History) > limits.MaxHistoryMessages {
+		return fmt.Errorf("%w: history has more than %d messages", ErrRequestTooLarge, limits.MaxHistoryMessages)
+	}
+
+	if (len(chat.Resources) > 0 || chat.MCPPrompt != "") && uc.mcpClient == nil {
+		return ErrMCPUnavailable
+	}
+	if chat.SystemPrompt == "" {
+		return nil
+	}
+	if uc.promptUC == nil {
+		return ErrPromptLibraryDisabled
+	}
+	_, err := uc.promptUC.Render(ctx, chat.SystemPrompt, dto.PromptVariables{Args: chat.PromptArgs})
+	return err
+}
+
+// Generations returns the registry of running and recently finished generations
+func (uc *StreamChatUsecase) Generations() *GenerationRegistry {
+	return uc.generations
+}
+
 // Execute handles the full chat flow with Ollama, including tool calling and persistence.
-func (uc *StreamChatUsecase) Execute(ctx context.Context, userPrompt string, onChunk func(dto.OllamaChatResponse) error) error {
-	tools := uc.getAvailableTools(ctx)
+// Progress is reported to onEvent as typed stream events, starting with a start event
+// carrying the generation ID and always terminated by an error, cancelled or done event.
+// Cancelling the generation through the registry aborts the model and tool calls in flight.
+func (uc *StreamChatUsecase) Execute(ctx context.Context, chat dto.ChatRequest, onEvent func(dto.StreamEvent) error) error {
+	gen, ctx := uc.generations.start(ctx, uc.model, chat.Caller, false)
+	return uc.generate(ctx, gen, chat, func(event dto.StreamEvent) error {
+		gen.publish(event)
+		return onEvent(event)
+	})
+}
+
+// Start runs a chat in the background, detached from the connection that requested it,
+// and returns its generation ID. The events are read through the registry with
+// Subscribe; the generation is abandoned when nobody follows it for a while.
+func (uc *StreamChatUsecase) Start(ctx context.Context, chat dto.ChatRequest) string {
+	gen, ctx := uc.generations.start(context.WithoutCancel(ctx), uc.model, chat.Caller, true)
+
+	go func() {
+		if err := uc.generate(ctx, gen, chat, func(event dto.StreamEvent) error {
+			gen.publish(event)
+			return nil
+		}); err != nil && !errors.Is(err, ErrGenerationCancelled) {
+			slog.ErrorContext(ctx, "generation failed", "error", err)
+		}
+	}()
+
+	return gen.id
+}
+
+func (uc *StreamChatUsecase) generate(ctx context.Context, gen *generation, chat dto.ChatRequest, onEvent func(dto.StreamEvent) error) error {
+	defer gen.cancel(nil)
+
+	emitter := newEventEmitter(func(event dto.StreamEvent) error {
+		if event.Type == dto.StreamEventToken {
+			gen.appendContent(event.Data.(dto.TokenEventData).Content)
+		}
+		return onEvent(event)
+	})
+
+	// One span covers every model round and tool call of the generation
+	ctx, span := tracing.Tracer().Start(ctx, "invoke_agent "+agentName, trace.WithAttributes(
+		semconv.GenAIOperationNameInvokeAgent,
+		semconv.GenAIAgentName(agentName),
+		semconv.GenAIRequestModel(uc.model),
+		attribute.String("generation_id", gen.id),
+	))
+	defer span.End()
+
+	// The Ollama queue takes turns between users and tells the client while it waits
+	if chat.Caller != nil {
+		ctx = ollama_infra.WithRequester(ctx, ollama_infra.Requester{User: chat.Caller.User, Role: chat.Caller.Role})
+	}
+	ctx = ollama_infra.WithQueueListener(ctx, func(position int) {
+		span.AddEvent("queued", trace.WithAttributes(attribute.Int("position", position)))
+		_ = emitter.emit(dto.StreamEventQueued, dto.QueuedEventData{Position: position})
+	})
+
+	slog.InfoContext(ctx, "chat started",
+		"model", uc.model,
+		"prompt", logging.Redact(ctx, chat.Prompt),
+		"history", len(chat.History),
+	)
+	err := emitter.emit(dto.StreamEventStart, dto.StartEventData{GenerationID: gen.id, Model: uc.model})
+	if err == nil {
+		err = uc.run(ctx, gen, chat, emitter)
+	}
+
+	// The last event is published before finishing so followers never miss it
+	switch {
+	case err == nil:
+		gen.finish(dto.GenerationCompleted)
+		return nil
+	case errors.Is(context.Cause(ctx), ErrGenerationCancelled):
+		slog.InfoContext(ctx, "generation cancelled")
+		span.AddEvent("cancelled")
+		// Best effort: the client may already be gone
+		_ = emitter.emit(dto.StreamEventCancelled, dto.CancelledEventData{Content: gen.partialContent()})
+		gen.finish(dto.GenerationCancelled)
+		return ErrGenerationCancelled
+	case ctx.Err() != nil:
+		// The client went away; nobody is listening for an error event
+		gen.finish(dto.GenerationCancelled)
+		return err
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		_ = emitter.emit(dto.StreamEventError, errorEventData(err))
+		gen.fail(err)
+		return err
+	}
+}
+
+func (uc *StreamChatUsecase) run(ctx context.Context, gen *generation, chat dto.ChatRequest, emitter *eventEmitter) error {
+	settings := uc.currentSettings()
+	tools := selectTools(ctx, uc.toolCache.Tools(ctx), chat, settings.toolPolicies)
+
+	systemPrompt, err := uc.resolveSystemPrompt(ctx, chat, tools, settings.systemPrompt)
+	if err != nil {
+		return err
+	}
 
 	var messages []dto.OllamaChatMessage = []dto.OllamaChatMessage{
-		{Role: "system", Content: uc.systemPrompt},
-		{Role: "user", Content: userPrompt},
+		{Role: "system", Content: systemPrompt},
+	}
+
+	// Ground the answer in the knowledge base when one is configured
+	passages := uc.retrievePassages(ctx, chat.Prompt)
+	if len(passages) > 0 {
+		messages = append(messages, dto.OllamaChatMessage{
+			Role:    "system",
+			Content: knowledgeContextPrompt + knowledge.FormatPassages(passages),
+		})
+
+		citations := make([]dto.Citation, 0, len(passages))
+		for _, p := range passages {
+			citations = append(citations, p.Citation)
+		}
+		if err := emitter.emit(dto.StreamEventCitations, dto.CitationsEventData{Citations: citations}); err != nil {
+			return err
+		}
+	}
+
+	// Resources attached by the client go in as context; images ride on the user message
+	userMessage := dto.OllamaChatMessage{Role: "user", Content: chat.Prompt}
+	for _, uri := range chat.Resources {
+		attached, images, err := uc.readResource(ctx, uri)
+		if err != nil {
+			return err
+		}
+		if attached != "" {
+			messages = append(messages, dto.OllamaChatMessage{Role: "system", Content: attached})
+		}
+		userMessage.Images = append(userMessage.Images, images...)
 	}
 
-	log.Printf("[MCP] Sending initial request to Ollama (Streaming mode)")
+	// A conversation started from an MCP prompt begins with the rendered prompt messages
+	if chat.MCPPrompt != "" {
+		promptMessages, err := uc.RenderMCPPrompt(ctx, chat.MCPPrompt, chat.MCPPromptArgs)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, promptMessages...)
+	}
+
+	messages = append(messages, chat.History...)
+	if userMessage.Content != "" || len(userMessage.Images) > 0 {
+		messages = append(messages, userMessage)
+	}
+
+	messages, err = uc.contextMgr.Fit(ctx, uc.model, messages, tools)
+	if err != nil {
+		return err
+	}
 
-	var fullContent string
-	var allToolCalls []dto.ToolCall
+	slog.DebugContext(ctx, "sending chat request to the model", "messages", len(messages), "tools", len(tools))
+
+	var usage dto.UsageEventData
 
 	request := dto.OllamaChatRequest{
 		Model:    uc.model,
 		Messages: messages,
 		Stream:   true,
 		Tools:    tools,
+		Options:  uc.contextMgr.Options(),
 	}
 
 	// Stream the first response and gather chunks
-	err := uc.ollamaClient.StreamChatRequest(ctx, request, func(chunk dto.OllamaChatResponse) error {
-		fullContent += chunk.Message.Content
-		if len(chunk.Message.ToolCalls) > 0 {
-			allToolCalls = append(allToolCalls, chunk.Message.ToolCalls...)
-		}
-		return onChunk(chunk)
-	})
-
+	round, err := uc.streamRound(ctx, 0, request, emitter, &usage)
 	if err != nil {
 		return err
 	}
 
 	// Handle tool execution if requested by the model
-	if len(allToolCalls) > 0 {
-		log.Printf("[MCP] Ollama requested %d tools", len(allToolCalls))
+	if len(round.toolCalls) > 0 {
+		slog.InfoContext(ctx, "model requested tool calls", "calls", len(round.toolCalls))
 
 		messages = append(messages, dto.OllamaChatMessage{
 			Role:      "assistant",
-			Content:   fullContent,
-			ToolCalls: allToolCalls,
+			Content:   round.content,
+			ToolCalls: round.toolCalls,
 		})
 
-		toolMessages, err := uc.toolExecutor.ExecuteToolCalls(ctx, allToolCalls)
+		for _, tc := range round.toolCalls {
+			if err := emitter.emit(dto.StreamEventToolCall, dto.ToolCallEventData{
+				ID:               tc.ID,
+				Index:            tc.Function.Index,
+				Name:             tc.Function.Name,
+				Arguments:        tc.Function.Arguments,
+				AwaitingApproval: chat.ApproveTools,
+			}); err != nil {
+				return err
+			}
+		}
+
+		results, err := uc.executeToolCalls(ctx, gen, chat.ApproveTools, round.toolCalls, tools)
 		if err != nil {
-			log.Printf("[MCP] Tool execution error: %v", err)
+			slog.ErrorContext(ctx, "tool execution error", "error", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 
-		messages = append(messages, toolMessages...)
+		for _, r := range results {
+			if err := emitter.emit(dto.StreamEventToolResult, dto.ToolResultEventData{
+				ID:      r.Call.ID,
+				Index:   r.Call.Function.Index,
+				Name:    r.Call.Function.Name,
+				Content: r.Message.Content,
+				IsError: r.IsError,
+			}); err != nil {
+				return err
+			}
+			messages = append(messages, r.Message)
+		}
 
-		log.Printf("[MCP] Sending final request with tool results")
+		slog.DebugContext(ctx, "sending tool results to the model")
 
-		fullContent = ""
-		allToolCalls = nil
+		// Tool results can be large; make sure the second round still fits
+		messages, err = uc.contextMgr.Fit(ctx, uc.model, messages, tools)
+		if err != nil {
+			return err
+		}
 
 		finalRequest := dto.OllamaChatRequest{
 			Model:    uc.model,
 			Messages: messages,
 			Stream:   true,
 			Tools:    tools,
+			Options:  uc.contextMgr.Options(),
 		}
 
-		err = uc.ollamaClient.StreamChatRequest(ctx, finalRequest, func(chunk dto.OllamaChatResponse) error {
-			fullContent += chunk.Message.Content
-			if len(chunk.Message.ToolCalls) > 0 {
-				allToolCalls = append(allToolCalls, chunk.Message.ToolCalls...)
-			}
-			return onChunk(chunk)
-		})
+		round, err = uc.streamRound(ctx, 1, finalRequest, emitter, &usage)
 		if err != nil {
 			return err
 		}
@@ -112,46 +383,204 @@ func (uc *StreamChatUsecase) Execute(ctx context.Context, userPrompt string, onC
 	// Add the final assistant response to the messages for caching
 	finalAssistantMsg := dto.OllamaChatMessage{
 		Role:    "assistant",
-		Content: fullContent,
+		Content: round.content,
 	}
-	if len(allToolCalls) > 0 {
-		finalAssistantMsg.ToolCalls = allToolCalls
+	if len(round.toolCalls) > 0 {
+		finalAssistantMsg.ToolCalls = round.toolCalls
 	}
 	messages = append(messages, finalAssistantMsg)
 
-	return nil
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	if err := emitter.emit(dto.StreamEventUsage, usage); err != nil {
+		return err
+	}
+
+	return emitter.emit(dto.StreamEventDone, dto.DoneEventData{
+		Content:    round.content,
+		DoneReason: round.doneReason,
+	})
+}
+
+// roundResult holds what the model produced during a single streamed request
+type roundResult struct {
+	content    string
+	toolCalls  []dto.ToolCall
+	doneReason string
+}
+
+// executeToolCalls runs the tool calls of a round. When approval is required only the
+// calls the client approves are executed; the model is told about the denied ones.
+func (uc *StreamChatUsecase) executeToolCalls(ctx context.Context, gen *generation, approve bool, calls []dto.ToolCall, tools []dto.Tool) ([]ToolCallResult, error) {
+	if !approve {
+		return uc.toolExecutor.ExecuteToolCalls(ctx, calls, tools)
+	}
+
+	ids := make([]string, 0, len(calls))
+	for _, tc := range calls {
+		ids = append(ids, tc.ID)
+	}
+	decisions, err := gen.awaitApprovals(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var approved []dto.ToolCall
+	for _, tc := range calls {
+		if decisions[tc.ID] {
+			approved = append(approved, tc)
+		}
+	}
+	executed, err := uc.toolExecutor.ExecuteToolCalls(ctx, approved, tools)
+
+	// Keep the results in the order of the calls
+	results := make([]ToolCallResult, 0, len(calls))
+	for _, tc := range calls {
+		if !decisions[tc.ID] {
+			results = append(results, DeniedToolCallResult(ctx, tc))
+			continue
+		}
+		for _, r := range executed {
+			if r.Call.ID == tc.ID {
+				results = append(results, r)
+			}
+		}
+	}
+	return results, err
+}
+
+// streamRound streams one request to Ollama, forwarding token events and accumulating usage.
+// number is the position of the round in the generation, starting at 0.
+func (uc *StreamChatUsecase) streamRound(
+	ctx context.Context,
+	number int,
+	request dto.OllamaChatRequest,
+	emitter *eventEmitter,
+	usage *dto.UsageEventData,
+) (*roundResult, error) {
+	result := &roundResult{}
+
+	err := uc.llmProvider.StreamChatRequest(ctx, request, func(chunk dto.OllamaChatResponse) error {
+		result.content += chunk.Message.Content
+		if len(chunk.Message.ToolCalls) > 0 {
+			result.toolCalls = append(result.toolCalls, chunk.Message.ToolCalls...)
+		}
+
+		if chunk.Done {
+			result.doneReason = chunk.DoneReason
+			usage.PromptTokens += chunk.PromptEvalCount
+			usage.CompletionTokens += chunk.EvalCount
+			usage.TotalDuration += chunk.TotalDuration
+			usage.LoadDuration += chunk.LoadDuration
+			usage.EvalDuration += chunk.EvalDuration
+		}
+
+		return emitter.emitChunk(chunk)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	AssignToolCallIDs(number, result.toolCalls)
+
+	return result, nil
 }
 
-// getAvailableTools fetches tools from the MCP client
-func (uc *StreamChatUsecase) getAvailableTools(ctx context.Context) []dto.Tool {
-	var tools []dto.Tool
+// readResource reads an MCP resource and returns its text for the model and any images
+func (uc *StreamChatUsecase) readResource(ctx context.Context, uri string) (string, []string, error) {
+	if uc.mcpClient == nil {
+		return "", nil, ErrMCPUnavailable
+	}
+
+	contents, err := uc.mcpClient.ReadResource(ctx, uri)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read resource %s: %w", uri, err)
+	}
+	slog.InfoContext(ctx, "attached resource", "uri", uri, "parts", len(contents))
+
+	var parts []string
+	var images []string
+	for _, c := range contents {
+		if blob, ok := c.(mcp.BlobResourceContents); ok && strings.HasPrefix(blob.MIMEType, "image/") {
+			images = append(images, blob.Blob)
+			continue
+		}
+		parts = append(parts, formatEmbeddedResource(c))
+	}
+
+	return strings.Join(parts, "\n\n"), images, nil
+}
 
+// RenderMCPPrompt renders a prompt on the MCP server and converts its messages
+func (uc *StreamChatUsecase) RenderMCPPrompt(ctx context.Context, name string, args map[string]string) ([]dto.OllamaChatMessage, error) {
 	if uc.mcpClient == nil {
-		return tools
+		return nil, ErrMCPUnavailable
 	}
 
-	mcpTools, err := uc.mcpClient.ListTools(ctx)
+	result, err := uc.mcpClient.GetPrompt(ctx, name, args)
 	if err != nil {
-		log.Printf("[MCP] Error listing tools: %v", err)
-		return tools
+		return nil, fmt.Errorf("failed to get prompt %s: %w", name, err)
 	}
+	slog.InfoContext(ctx, "starting conversation from MCP prompt", "prompt_name", name, "messages", len(result.Messages))
 
-	if len(mcpTools) == 0 {
-		return tools
+	messages := make([]dto.OllamaChatMessage, 0, len(result.Messages))
+	for _, pm := range result.Messages {
+		msg := dto.OllamaChatMessage{Role: string(pm.Role)}
+		switch content := pm.Content.(type) {
+		case mcp.TextContent:
+			msg.Content = content.Text
+		case mcp.ImageContent:
+			msg.Images = append(msg.Images, content.Data)
+		case mcp.EmbeddedResource:
+			msg.Content = formatEmbeddedResource(content.Resource)
+		case mcp.ResourceLink:
+			msg.Content = fmt.Sprintf("[resource %s: %s]", content.Name, content.URI)
+		default:
+			b, _ := json.Marshal(pm.Content)
+			msg.Content = string(b)
+		}
+		messages = append(messages, msg)
 	}
 
-	log.Printf("[MCP] Discovered %d tools", len(mcpTools))
+	return messages, nil
+}
+
+// resolveSystemPrompt renders the library prompt chosen by the request, or returns the default one
+func (uc *StreamChatUsecase) resolveSystemPrompt(ctx context.Context, chat dto.ChatRequest, tools []dto.Tool, defaultPrompt string) (string, error) {
+	if chat.SystemPrompt == "" {
+		return defaultPrompt, nil
+	}
+	if uc.promptUC == nil {
+		return "", ErrPromptLibraryDisabled
+	}
 
-	for _, t := range mcpTools {
-		tools = append(tools, dto.Tool{
-			Type: "function",
-			Function: dto.ToolFunction{
-				Name:        t.Name,
-				Description: t.Description,
-				Parameters:  t.InputSchema,
-			},
-		})
+	toolNames := make([]string, 0, len(tools))
+	for _, t := range tools {
+		toolNames = append(toolNames, t.Function.Name)
+	}
+
+	return uc.promptUC.Render(ctx, chat.SystemPrompt, dto.PromptVariables{
+		UserName: chat.UserName,
+		Model:    uc.model,
+		Tools:    toolNames,
+		Args:     chat.PromptArgs,
+	})
+}
+
+const knowledgeContextPrompt = "The following passages were retrieved from the knowledge base. " +
+	"Use them when they are relevant and cite them by their [number].\n\n"
+
+// retrievePassages looks up knowledge base passages relevant to the prompt
+func (uc *StreamChatUsecase) retrievePassages(ctx context.Context, prompt string) []dto.KnowledgePassage {
+	if uc.knowledgeUC == nil || strings.TrimSpace(prompt) == "" {
+		return nil
+	}
+
+	passages, err := uc.knowledgeUC.Retrieve(ctx, prompt)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving passages", "error", err)
+		return nil
 	}
 
-	return tools
+	slog.InfoContext(ctx, "retrieved passages", "passages", len(passages))
+	return passages
 }
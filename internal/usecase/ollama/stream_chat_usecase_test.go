@@ -0,0 +1,710 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/infrastructure/ollama"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+)
+
+func newTestChat(t *testing.T, fake *testsupport.FakeOllama, withMCP bool) *StreamChatUsecase {
+	t.Helper()
+
+	var client mcpclient.MCPClient
+	if withMCP {
+		client = testsupport.NewMCPClient(t, testsupport.NewMCPServer())
+	}
+
+	config := ollama_infra.DefaultClientConfig()
+	config.MaxRetries = 0
+	provider := ollama_infra.NewOllamaClientWithConfig(fake.URL(), config)
+
+	return NewStreamChatUsecase(
+		provider,
+		"test-model",
+		"You are a test.",
+		client,
+		NewToolCache(client, 0),
+		nil,
+		nil,
+		ContextPolicy{},
+		dto.ToolPolicies{},
+		ChatLimits{},
+	)
+}
+
+// recorder collects the events of a chat; it is safe to use from the streaming goroutine
+type recorder struct {
+	mu     sync.Mutex
+	events []dto.StreamEvent
+}
+
+func (r *recorder) onEvent(event dto.StreamEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recorder) types() []dto.StreamEventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := make([]dto.StreamEventType, 0, len(r.events))
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func (r *recorder) last() dto.StreamEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events[len(r.events)-1]
+}
+
+func equalTypes(got []dto.StreamEventType, want ...dto.StreamEventType) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStreamChatText(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("Hello", " world"))
+	uc := newTestChat(t, fake, false)
+
+	var rec recorder
+	if err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "hi"}, rec.onEvent); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	want := []dto.StreamEventType{
+		dto.StreamEventStart, dto.StreamEventToken, dto.StreamEventToken, dto.StreamEventUsage, dto.StreamEventDone,
+	}
+	if got := rec.types(); !equalTypes(got, want...) {
+		t.Fatalf("got events %v", got)
+	}
+	for i, e := range rec.events {
+		if e.ID != int64(i+1) {
+			t.Errorf("event %d has id %d, want %d", i, e.ID, i+1)
+		}
+	}
+
+	start := rec.events[0].Data.(dto.StartEventData)
+	if start.GenerationID == "" || start.Model != "test-model" {
+		t.Errorf("got start %+v", start)
+	}
+	status, err := uc.Generations().Status(start.GenerationID, nil, false)
+	if err != nil || status.Status != dto.GenerationCompleted || status.Content != "Hello world" {
+		t.Errorf("got generation %+v, %v", status, err)
+	}
+
+	usage := rec.events[3].Data.(dto.UsageEventData)
+	if usage.PromptTokens != 10 || usage.CompletionTokens != 5 || usage.TotalTokens != 15 {
+		t.Errorf("got usage %+v", usage)
+	}
+	if done := rec.last().Data.(dto.DoneEventData); done.Content != "Hello world" || done.DoneReason != "stop" {
+		t.Errorf("got done %+v", done)
+	}
+
+	request := fake.ChatRequests()[0]
+	if request.Model != "test-model" || len(request.Messages) != 2 ||
+		request.Messages[0].Content != "You are a test." || request.Messages[1].Content != "hi" {
+		t.Errorf("unexpected request %+v", request)
+	}
+}
+
+func TestStreamChatToolLoop(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(
+		testsupport.ToolCallTurn(testsupport.ToolCall("echo", map[string]any{"text": "pong"})),
+		testsupport.TextTurn("The tool said pong"),
+	)
+	uc := newTestChat(t, fake, true)
+
+	var rec recorder
+	if err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "ping"}, rec.onEvent); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	want := []dto.StreamEventType{
+		dto.StreamEventStart, dto.StreamEventToolCall, dto.StreamEventToolResult,
+		dto.StreamEventToken, dto.StreamEventUsage, dto.StreamEventDone,
+	}
+	if got := rec.types(); !equalTypes(got, want...) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+
+	result := rec.events[2].Data.(dto.ToolResultEventData)
+	if result.Name != "echo" || result.Content != "pong" || result.IsError || result.ID != "call_0_0" {
+		t.Errorf("got tool result %+v", result)
+	}
+
+	requests := fake.ChatRequests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d chat requests, want 2", len(requests))
+	}
+	if len(requests[0].Tools) == 0 {
+		t.Error("the MCP tools were not offered to the model")
+	}
+	messages := requests[1].Messages
+	toolMessage := messages[len(messages)-1]
+	if toolMessage.Role != "tool" || toolMessage.Content != "pong" || toolMessage.ToolCallID != "call_0_0" {
+		t.Errorf("second round does not end with the tool result: %+v", toolMessage)
+	}
+	if assistant := messages[len(messages)-2]; assistant.Role != "assistant" || len(assistant.ToolCalls) != 1 {
+		t.Errorf("second round does not carry the tool call: %+v", assistant)
+	}
+
+	usage := rec.events[4].Data.(dto.UsageEventData)
+	if usage.PromptTokens != 20 || usage.CompletionTokens != 10 {
+		t.Errorf("usage is not summed across rounds: %+v", usage)
+	}
+}
+
+func TestStreamChatRestrictsTools(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(
+		testsupport.ToolCallTurn(testsupport.ToolCall("add", map[string]any{"a": 1, "b": 2})),
+		testsupport.TextTurn("no"),
+	)
+	uc := newTestChat(t, fake, true)
+
+	var rec recorder
+	if err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "x", Tools: []string{"echo"}}, rec.onEvent); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	if tools := fake.ChatRequests()[0].Tools; len(tools) != 1 || tools[0].Function.Name != "echo" {
+		t.Errorf("got offered tools %+v", tools)
+	}
+	result := rec.events[2].Data.(dto.ToolResultEventData)
+	if !result.IsError || !strings.Contains(result.Content, "not available") {
+		t.Errorf("call to a tool that was not offered was not rejected: %+v", result)
+	}
+}
+
+func TestStreamChatProviderError(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.ChatTurn{Status: http.StatusInternalServerError, Error: "boom"})
+	uc := newTestChat(t, fake, false)
+
+	var rec recorder
+	err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "hi"}, rec.onEvent)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got := rec.types(); !equalTypes(got, dto.StreamEventStart, dto.StreamEventError) {
+		t.Fatalf("got events %v", got)
+	}
+	if msg := rec.last().Data.(dto.ErrorEventData).Message; !strings.Contains(msg, "boom") {
+		t.Errorf("error event does not carry the cause: %q", msg)
+	}
+}
+
+func TestStreamChatMidStreamError(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("partial")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Error = "model crashed"
+	fake.ScriptChat(turn)
+	uc := newTestChat(t, fake, false)
+
+	var rec recorder
+	if err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "hi"}, rec.onEvent); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := rec.types(); !equalTypes(got, dto.StreamEventStart, dto.StreamEventToken, dto.StreamEventError) {
+		t.Fatalf("got events %v", got)
+	}
+}
+
+func TestStreamChatCancelled(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("first")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn)
+	uc := newTestChat(t, fake, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var rec recorder
+	errc := make(chan error, 1)
+	go func() {
+		errc <- uc.Execute(ctx, dto.ChatRequest{Prompt: "hi"}, func(event dto.StreamEvent) error {
+			rec.onEvent(event)
+			if event.Type == dto.StreamEventToken {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("chat did not stop after cancellation")
+	}
+
+	// Nobody is listening any more, so no error event is sent
+	if got := rec.types(); !equalTypes(got, dto.StreamEventStart, dto.StreamEventToken) {
+		t.Errorf("got events %v", got)
+	}
+}
+
+func TestStreamChatClientGone(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("a", "b", "c"))
+	uc := newTestChat(t, fake, false)
+
+	gone := errors.New("write: broken pipe")
+	err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "hi"}, func(dto.StreamEvent) error {
+		return gone
+	})
+	if !errors.Is(err, gone) {
+		t.Errorf("expected the write error, got %v", err)
+	}
+}
+
+func TestStreamChatValidateLimits(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	uc := newTestChat(t, fake, false)
+	uc.Reconfigure("You are a test.", dto.ToolPolicies{}, ChatLimits{MaxPromptChars: 5, MaxHistoryMessages: 1})
+
+	if err := uc.Validate(context.Background(), dto.ChatRequest{Prompt: "hello"}); err != nil {
+		t.Errorf("prompt at the limit rejected: %v", err)
+	}
+	if err := uc.Validate(context.Background(), dto.ChatRequest{Prompt: "hello!"}); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("long prompt: got %v", err)
+	}
+	history := []dto.OllamaChatMessage{{Role: "user"}, {Role: "assistant"}}
+	if err := uc.Validate(context.Background(), dto.ChatRequest{Prompt: "hi", History: history}); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("long history: got %v", err)
+	}
+	if err := uc.Validate(context.Background(), dto.ChatRequest{Prompt: "hi", Resources: []string{"system://metrics"}}); !errors.Is(err, ErrMCPUnavailable) {
+		t.Errorf("resources without MCP: got %v", err)
+	}
+}
+
+func TestStreamChatReconfigureSystemPrompt(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("ok"))
+	uc := newTestChat(t, fake, false)
+	uc.Reconfigure("Reloaded prompt", dto.ToolPolicies{}, ChatLimits{})
+
+	var rec recorder
+	if err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "hi"}, rec.onEvent); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := fake.ChatRequests()[0].Messages[0].Content; got != "Reloaded prompt" {
+		t.Errorf("got system prompt %q", got)
+	}
+}
+
+func TestStreamChatCancelGeneration(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("partial answer")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn)
+	uc := newTestChat(t, fake, false)
+
+	var rec recorder
+	ids := make(chan string, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- uc.Execute(context.Background(), dto.ChatRequest{Prompt: "hi"}, func(event dto.StreamEvent) error {
+			rec.onEvent(event)
+			if event.Type == dto.StreamEventToken {
+				ids <- rec.events[0].Data.(dto.StartEventData).GenerationID
+			}
+			return nil
+		})
+	}()
+
+	id := <-ids
+	if err := uc.Generations().Cancel(id, nil, false); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrGenerationCancelled) {
+			t.Errorf("expected ErrGenerationCancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("generation did not stop after cancellation")
+	}
+
+	if got := rec.types(); !equalTypes(got, dto.StreamEventStart, dto.StreamEventToken, dto.StreamEventCancelled) {
+		t.Fatalf("got events %v", got)
+	}
+	if content := rec.last().Data.(dto.CancelledEventData).Content; content != "partial answer" {
+		t.Errorf("cancelled event carries %q", content)
+	}
+
+	status, err := uc.Generations().Status(id, nil, false)
+	if err != nil || status.Status != dto.GenerationCancelled || status.Content != "partial answer" || status.FinishedAt == nil {
+		t.Errorf("got generation %+v, %v", status, err)
+	}
+	if err := uc.Generations().Cancel(id, nil, false); !errors.Is(err, ErrGenerationFinished) {
+		t.Errorf("cancelling twice: got %v", err)
+	}
+}
+
+func TestStreamChatCancelDuringToolCall(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.ToolCallTurn(
+		testsupport.ToolCall("slow", nil),
+		testsupport.ToolCall("echo", map[string]any{"text": "never"}),
+	))
+	uc := newTestChat(t, fake, true)
+
+	var rec recorder
+	errc := make(chan error, 1)
+	go func() {
+		errc <- uc.Execute(context.Background(), dto.ChatRequest{Prompt: "hi"}, func(event dto.StreamEvent) error {
+			rec.onEvent(event)
+			if event.Type == dto.StreamEventToolCall && event.Data.(dto.ToolCallEventData).Name == "echo" {
+				// Both calls announced; the slow one is about to block
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					uc.Generations().Cancel(rec.events[0].Data.(dto.StartEventData).GenerationID, nil, false)
+				}()
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrGenerationCancelled) {
+			t.Errorf("expected ErrGenerationCancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tool call was not cancelled")
+	}
+
+	for _, typ := range rec.types() {
+		if typ == dto.StreamEventToolResult {
+			t.Error("tool results were emitted after the cancellation")
+		}
+	}
+	if n := len(fake.ChatRequests()); n != 1 {
+		t.Errorf("got %d chat requests, the second round should not start", n)
+	}
+}
+
+func TestGenerationOwnership(t *testing.T) {
+	registry := NewGenerationRegistry()
+	ana := &dto.Caller{User: "ana", Role: "user"}
+	gen, _ := registry.start(context.Background(), "m", ana, false)
+	defer gen.cancel(nil)
+
+	if err := registry.Cancel(gen.id, &dto.Caller{User: "bob"}, false); !errors.Is(err, ErrGenerationForbidden) {
+		t.Errorf("other user: got %v", err)
+	}
+	if _, err := registry.Status(gen.id, nil, false); !errors.Is(err, ErrGenerationForbidden) {
+		t.Errorf("anonymous: got %v", err)
+	}
+	if _, err := registry.Status(gen.id, &dto.Caller{User: "root"}, true); err != nil {
+		t.Errorf("admin: got %v", err)
+	}
+	if err := registry.Cancel("missing", ana, false); !errors.Is(err, ErrGenerationNotFound) {
+		t.Errorf("unknown id: got %v", err)
+	}
+	if err := registry.Cancel(gen.id, ana, false); err != nil {
+		t.Errorf("owner: got %v", err)
+	}
+}
+
+func TestAnonymousGenerationIsBoundToTheClientAddress(t *testing.T) {
+	registry := NewGenerationRegistry()
+	gen, _ := registry.start(context.Background(), "m", &dto.Caller{Address: "10.0.0.1"}, false)
+	defer gen.cancel(nil)
+
+	if _, err := registry.Status(gen.id, &dto.Caller{Address: "10.0.0.2"}, false); !errors.Is(err, ErrGenerationForbidden) {
+		t.Errorf("other address: got %v", err)
+	}
+	if _, err := registry.Status(gen.id, &dto.Caller{User: "ana", Address: "10.0.0.1"}, false); !errors.Is(err, ErrGenerationForbidden) {
+		t.Errorf("authenticated user: got %v", err)
+	}
+	if _, err := registry.Status(gen.id, nil, false); !errors.Is(err, ErrGenerationForbidden) {
+		t.Errorf("no caller: got %v", err)
+	}
+	if err := registry.Cancel(gen.id, &dto.Caller{Address: "10.0.0.1"}, false); err != nil {
+		t.Errorf("same address: got %v", err)
+	}
+}
+
+func TestFinishedGenerationCompactsTokenEvents(t *testing.T) {
+	registry := NewGenerationRegistry()
+	gen, _ := registry.start(context.Background(), "m", nil, false)
+	defer gen.cancel(nil)
+
+	gen.publish(dto.StreamEvent{ID: 1, Type: dto.StreamEventStart})
+	gen.publish(dto.StreamEvent{ID: 2, Type: dto.StreamEventToken, Data: dto.TokenEventData{Content: "Hel"}})
+	gen.publish(dto.StreamEvent{ID: 3, Type: dto.StreamEventToken, Data: dto.TokenEventData{Content: "lo"}})
+	gen.publish(dto.StreamEvent{ID: 4, Type: dto.StreamEventToolCall})
+	gen.publish(dto.StreamEvent{ID: 5, Type: dto.StreamEventToken, Data: dto.TokenEventData{Content: "!"}})
+	gen.publish(dto.StreamEvent{ID: 6, Type: dto.StreamEventDone})
+	gen.finish(dto.GenerationCompleted)
+
+	events, finished, _ := gen.eventsAfter(0)
+	if !finished {
+		t.Fatal("the generation should be finished")
+	}
+	want := []dto.StreamEvent{
+		{ID: 1, Type: dto.StreamEventStart},
+		{ID: 3, Type: dto.StreamEventToken, Data: dto.TokenEventData{Content: "Hello"}},
+		{ID: 4, Type: dto.StreamEventToolCall},
+		{ID: 5, Type: dto.StreamEventToken, Data: dto.TokenEventData{Content: "!"}},
+		{ID: 6, Type: dto.StreamEventDone},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events %+v, want %+v", events, want)
+	}
+	if events, _, _ := gen.eventsAfter(3); len(events) != 3 || events[0].ID != 4 {
+		t.Errorf("resuming after 3: got %+v", events)
+	}
+}
+
+func TestFinishedGenerationIsForgottenAfterRetention(t *testing.T) {
+	registry := NewGenerationRegistry()
+	registry.SetRetention(10 * time.Millisecond)
+	gen, _ := registry.start(context.Background(), "m", nil, false)
+	defer gen.cancel(nil)
+
+	gen.finish(dto.GenerationCompleted)
+	if _, err := registry.Status(gen.id, nil, false); err != nil {
+		t.Fatalf("just finished: got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := registry.Status(gen.id, nil, false)
+		if errors.Is(err, ErrGenerationNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still registered after the retention: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStartedGenerationIsAbandonedWithoutFollowers(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	turn := testsupport.TextTurn("partial")
+	turn.Chunks = turn.Chunks[:1]
+	turn.Hang = true
+	fake.ScriptChat(turn)
+	uc := newTestChat(t, fake, false)
+	uc.generations.resumeWindow = 100 * time.Millisecond
+
+	id := uc.Start(context.Background(), dto.ChatRequest{Prompt: "hi"})
+	sub, err := uc.Generations().Subscribe(id, nil, false)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	// Follow until the first token, then drop like a lost connection
+	ctx, cancel := context.WithCancel(context.Background())
+	var rec recorder
+	sub.Stream(ctx, 0, func(event dto.StreamEvent) error {
+		rec.onEvent(event)
+		if event.Type == dto.StreamEventToken {
+			cancel()
+		}
+		return nil
+	})
+
+	// Reconnecting within the window keeps it alive and replays from the last event
+	sub, err = uc.Generations().Subscribe(id, nil, false)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if status, _ := uc.Generations().Status(id, nil, false); status.Status != dto.GenerationRunning {
+		t.Fatalf("generation stopped while followed: %s", status.Status)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var resumed recorder
+	sub.Stream(ctx, rec.last().ID, resumed.onEvent)
+	if got := resumed.types(); len(got) != 0 {
+		t.Errorf("replayed events already delivered: %v", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := uc.Generations().Status(id, nil, false)
+		if err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		if status.Status == dto.GenerationCancelled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("generation was not abandoned, status %s", status.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscriptionReplaysFinishedGeneration(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(testsupport.TextTurn("a", "b"))
+	uc := newTestChat(t, fake, false)
+
+	var live recorder
+	if err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "hi"}, live.onEvent); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	id := live.events[0].Data.(dto.StartEventData).GenerationID
+
+	sub, err := uc.Generations().Subscribe(id, nil, false)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	var replay recorder
+	if err := sub.Stream(context.Background(), 2, replay.onEvent); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	want := live.types()[2:]
+	if got := replay.types(); !equalTypes(got, want...) {
+		t.Errorf("replayed %v, want %v", got, want)
+	}
+	if replay.events[0].ID != 3 {
+		t.Errorf("replay starts at id %d", replay.events[0].ID)
+	}
+}
+
+func TestStreamChatToolApproval(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	fake.ScriptChat(
+		testsupport.ToolCallTurn(testsupport.ToolCall("echo", map[string]any{"text": "pong"})),
+		testsupport.TextTurn("denied"),
+	)
+	uc := newTestChat(t, fake, true)
+
+	var rec recorder
+	err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "ping", ApproveTools: true}, func(event dto.StreamEvent) error {
+		rec.onEvent(event)
+		if event.Type == dto.StreamEventToolCall {
+			id := rec.events[0].Data.(dto.StartEventData).GenerationID
+			go func() {
+				// The decision may arrive before the usecase starts waiting
+				for uc.Generations().Approve(id, "call_0_0", false, nil, false) != nil {
+					time.Sleep(time.Millisecond)
+				}
+			}()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	result := rec.events[2].Data.(dto.ToolResultEventData)
+	if !result.IsError || !strings.Contains(result.Content, "denied") {
+		t.Errorf("got tool result %+v", result)
+	}
+	if id := rec.events[0].Data.(dto.StartEventData).GenerationID; !errors.Is(uc.Generations().Approve(id, "call_0_0", true, nil, false), ErrApprovalNotPending) {
+		t.Error("a call could be approved after it was decided")
+	}
+}
+
+func TestStreamChatReportsQueuePosition(t *testing.T) {
+	fake := testsupport.NewFakeOllama(t)
+	busy := testsupport.TextTurn("busy")
+	busy.Chunks = busy.Chunks[:1]
+	busy.Hang = true
+	fake.ScriptChat(busy, testsupport.TextTurn("served"))
+
+	config := ollama_infra.DefaultClientConfig()
+	config.MaxRetries = 0
+	queue := ollama_infra.NewQueue(ollama_infra.NewOllamaClientWithConfig(fake.URL(), config), ollama_infra.QueueConfig{
+		MaxConcurrent: 1,
+		MaxLength:     1,
+	})
+	uc := NewStreamChatUsecase(queue, "test-model", "You are a test.", nil, NewToolCache(nil, 0),
+		nil, nil, ContextPolicy{}, dto.ToolPolicies{}, ChatLimits{})
+
+	// The first chat holds the only slot
+	ids := make(chan string, 1)
+	go uc.Execute(context.Background(), dto.ChatRequest{Prompt: "first"}, func(event dto.StreamEvent) error {
+		if data, ok := event.Data.(dto.StartEventData); ok {
+			ids <- data.GenerationID
+		}
+		return nil
+	})
+	first := <-ids
+	for len(fake.ChatRequests()) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var rec recorder
+	errc := make(chan error, 1)
+	go func() {
+		errc <- uc.Execute(context.Background(), dto.ChatRequest{Prompt: "second"}, func(event dto.StreamEvent) error {
+			rec.onEvent(event)
+			if event.Type == dto.StreamEventQueued {
+				uc.Generations().Cancel(first, nil, false)
+			}
+			return nil
+		})
+	}()
+
+	if err := <-errc; err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got := rec.types(); len(got) < 2 || got[1] != dto.StreamEventQueued || got[len(got)-1] != dto.StreamEventDone {
+		t.Fatalf("got events %v", got)
+	}
+	if position := rec.events[1].Data.(dto.QueuedEventData).Position; position != 1 {
+		t.Errorf("got position %d", position)
+	}
+
+	// A third chat finds the queue full while the second one waits
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake.ScriptChat(busy)
+	go uc.Execute(ctx, dto.ChatRequest{Prompt: "holder"}, func(dto.StreamEvent) error { return nil })
+	for len(fake.ChatRequests()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	go uc.Execute(ctx, dto.ChatRequest{Prompt: "waiting"}, func(dto.StreamEvent) error { return nil })
+	for queue.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var refused recorder
+	if err := uc.Execute(context.Background(), dto.ChatRequest{Prompt: "refused"}, refused.onEvent); !errors.Is(err, ollama_infra.ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if data := refused.last().Data.(dto.ErrorEventData); data.Code != http.StatusServiceUnavailable {
+		t.Errorf("got error event %+v", data)
+	}
+}
@@ -0,0 +1,320 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+// ArgumentProblem is one reason why tool call arguments don't match the input schema
+type ArgumentProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// invalidArgumentsError is sent back to the model so it can fix the call in the next round
+type invalidArgumentsError struct {
+	Error    string            `json:"error"`
+	Tool     string            `json:"tool"`
+	Problems []ArgumentProblem `json:"problems"`
+	Hint     string            `json:"hint"`
+}
+
+// ValidateArguments checks tool call arguments against the tool input schema. Values with
+// an obviously fixable type are coerced ("5" to 5 for integers, "true" to true for
+// booleans, 5 to "5" for strings); the fixed arguments are returned with any problems left.
+func ValidateArguments(schema mcp.ToolInputSchema, args dto.ComponentArguments) (dto.ComponentArguments, []ArgumentProblem) {
+	root := map[string]any{
+		"type":       "object",
+		"properties": schema.Properties,
+		"required":   toAnySlice(schema.Required),
+	}
+
+	// Work on a copy: the original arguments stay in the conversation as the model sent them
+	var copied map[string]any
+	if b, err := json.Marshal(args); err == nil {
+		_ = json.Unmarshal(b, &copied)
+	}
+
+	var problems []ArgumentProblem
+	fixed := validateValue(root, copied, "", &problems)
+	out, _ := fixed.(map[string]any)
+	if out == nil {
+		out = map[string]any{}
+	}
+	return dto.ComponentArguments(out), problems
+}
+
+// invalidArgumentsMessage formats the problems as the JSON tool message the model receives
+func invalidArgumentsMessage(tool string, problems []ArgumentProblem) string {
+	b, _ := json.Marshal(invalidArgumentsError{
+		Error:    "invalid_arguments",
+		Tool:     tool,
+		Problems: problems,
+		Hint:     "The tool was not executed. Fix the arguments to match the tool's parameter schema and call it again.",
+	})
+	return string(b)
+}
+
+func validateValue(schema map[string]any, value any, path string, problems *[]ArgumentProblem) any {
+	report := func(format string, a ...any) {
+		p := path
+		if p == "" {
+			p = "(arguments)"
+		}
+		*problems = append(*problems, ArgumentProblem{Path: p, Message: fmt.Sprintf(format, a...)})
+	}
+
+	types := schemaTypes(schema["type"])
+	if len(types) > 0 && !matchesAny(types, value) {
+		coerced, ok := coerce(types, value)
+		if !ok {
+			report("expected %s, got %s", strings.Join(types, " or "), describe(value))
+			return value
+		}
+		value = coerced
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		if !slices.ContainsFunc(enum, func(e any) bool { return reflect.DeepEqual(normalizeNumber(e), normalizeNumber(value)) }) {
+			b, _ := json.Marshal(enum)
+			report("must be one of %s", b)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for _, name := range toStrings(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, ArgumentProblem{Path: joinPath(path, name), Message: "is required"})
+			}
+		}
+		for _, name := range sortedKeysOf(v) {
+			propSchema, ok := props[name].(map[string]any)
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					*problems = append(*problems, ArgumentProblem{Path: joinPath(path, name), Message: "is not a known parameter"})
+				}
+				continue
+			}
+			v[name] = validateValue(propSchema, v[name], joinPath(path, name), problems)
+		}
+		return v
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i := range v {
+				v[i] = validateValue(items, v[i], fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// coerce converts value to the first schema type it can be losslessly turned into
+func coerce(types []string, value any) (any, bool) {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if s, ok := value.(string); ok {
+				if n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+					return float64(n), true
+				}
+			}
+		case "number":
+			if s, ok := value.(string); ok {
+				if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+					return n, true
+				}
+			}
+		case "boolean":
+			if s, ok := value.(string); ok {
+				if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+					return b, true
+				}
+			}
+		case "string":
+			switch v := value.(type) {
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64), true
+			case bool:
+				return strconv.FormatBool(v), true
+			}
+		case "array":
+			// Models sometimes send a JSON encoded array as a string
+			if s, ok := value.(string); ok {
+				var arr []any
+				if json.Unmarshal([]byte(s), &arr) == nil {
+					return arr, true
+				}
+			}
+		case "object":
+			if s, ok := value.(string); ok {
+				var obj map[string]any
+				if json.Unmarshal([]byte(s), &obj) == nil {
+					return obj, true
+				}
+			}
+		}
+	}
+	return value, false
+}
+
+func matchesAny(types []string, value any) bool {
+	for _, t := range types {
+		if matchesType(t, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(t string, value any) bool {
+	switch t {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		return isNumber(value)
+	case "integer":
+		if !isNumber(value) {
+			return false
+		}
+		f := normalizeNumber(value).(float64)
+		return f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return true
+	}
+}
+
+func isNumber(value any) bool {
+	switch value.(type) {
+	case float64, float32, int, int64, int32, json.Number:
+		return true
+	default:
+		return false
+	}
+}
+
+// normalizeNumber makes numbers comparable regardless of their Go type
+func normalizeNumber(value any) any {
+	switch v := value.(type) {
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	default:
+		return value
+	}
+}
+
+func schemaTypes(t any) []string {
+	switch v := t.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		return toStrings(v)
+	case []string:
+		return v
+	default:
+		return nil
+	}
+}
+
+func describe(value any) string {
+	if value == nil {
+		return "null"
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	s := string(b)
+	if len(s) > 60 {
+		s = s[:60] + "..."
+	}
+	switch value.(type) {
+	case string:
+		return "string " + s
+	case bool:
+		return "boolean " + s
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array " + s
+	default:
+		if isNumber(value) {
+			return "number " + s
+		}
+		return s
+	}
+}
+
+func toStrings(v any) []string {
+	switch items := v.(type) {
+	case []string:
+		return items
+	case []any:
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func toAnySlice(items []string) []any {
+	out := make([]any, 0, len(items))
+	for _, s := range items {
+		out = append(out, s)
+	}
+	return out
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func sortedKeysOf(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
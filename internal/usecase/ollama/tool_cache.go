@@ -0,0 +1,247 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/metalpoch/local-synapse/internal/dto"
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+)
+
+// DefaultToolsTTL is how long the tool list is reused when the server sends no change notifications
+const DefaultToolsTTL = 5 * time.Minute
+
+const (
+	// toolsListTimeout bounds a tools/list request, which runs detached from the chats
+	// that need it
+	toolsListTimeout = 30 * time.Second
+	// toolsRetryInterval keeps a failing server from being listed again on every chat
+	toolsRetryInterval = 10 * time.Second
+)
+
+var jsonSchemaTypes = []string{"string", "number", "integer", "boolean", "object", "array", "null"}
+
+// ToolCache keeps the MCP tools converted to the Ollama format. The list is refreshed
+// when the server reports notifications/tools/list_changed, when the TTL expires or
+// on demand. Tools with a malformed input schema are left out so they can't break chats.
+//
+// The server is never listed while holding the lock: a single tools/list request runs
+// at a time and the previous list keeps being served until it finishes.
+type ToolCache struct {
+	mcpClient mcpclient.MCPClient
+	ttl       time.Duration
+
+	// stale is set from the MCP client's notification handler, which must not block:
+	// the client delivers responses on the same goroutine
+	stale atomic.Bool
+
+	mu        sync.Mutex
+	tools     []dto.Tool
+	loaded    bool
+	fetchedAt time.Time
+	failedAt  time.Time
+	refresh   *toolsRefresh
+}
+
+// toolsRefresh is a tools/list request in flight, shared by everyone waiting for it
+type toolsRefresh struct {
+	done  chan struct{}
+	tools []dto.Tool
+	err   error
+}
+
+// NewToolCache creates a tool cache. mcpClient may be nil, in which case no tools are offered.
+func NewToolCache(mcpClient mcpclient.MCPClient, ttl time.Duration) *ToolCache {
+	if ttl <= 0 {
+		ttl = DefaultToolsTTL
+	}
+
+	c := &ToolCache{mcpClient: mcpClient, ttl: ttl}
+	c.stale.Store(true)
+	if mcpClient != nil {
+		mcpClient.OnToolsChanged(func() {
+			slog.Info("MCP tool list changed, invalidating cache")
+			c.Invalidate()
+		})
+	}
+	return c
+}
+
+// Tools returns the cached tools. When they are stale a refresh starts in the background
+// and the previous list is returned; only the first load is waited for. If a refresh
+// fails the previous list is kept.
+func (c *ToolCache) Tools(ctx context.Context) []dto.Tool {
+	if c.mcpClient == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.refresh == nil && c.needsRefreshLocked() {
+		c.startRefreshLocked(ctx)
+	}
+	tools, loaded, r := c.tools, c.loaded, c.refresh
+	c.mu.Unlock()
+
+	if loaded || r == nil {
+		return tools
+	}
+	select {
+	case <-r.done:
+		return r.tools
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// Refresh reloads the tool list now and returns it
+func (c *ToolCache) Refresh(ctx context.Context) ([]dto.Tool, error) {
+	if c.mcpClient == nil {
+		return nil, ErrMCPUnavailable
+	}
+
+	c.mu.Lock()
+	r := c.startRefreshLocked(ctx)
+	c.mu.Unlock()
+
+	select {
+	case <-r.done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return r.tools, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Invalidate marks the list as stale so the next request reloads it. It never blocks.
+func (c *ToolCache) Invalidate() {
+	c.stale.Store(true)
+}
+
+func (c *ToolCache) needsRefreshLocked() bool {
+	if !c.failedAt.IsZero() && time.Since(c.failedAt) < toolsRetryInterval {
+		return false
+	}
+	return c.stale.Load() || time.Since(c.fetchedAt) > c.ttl
+}
+
+// startRefreshLocked lists the tools in the background, or returns the request
+// already in flight
+func (c *ToolCache) startRefreshLocked(ctx context.Context) *toolsRefresh {
+	if c.refresh != nil {
+		return c.refresh
+	}
+
+	r := &toolsRefresh{done: make(chan struct{})}
+	c.refresh = r
+	// Changes reported from now on need another refresh
+	c.stale.Store(false)
+
+	// Others may be waiting for the result, so the caller going away does not cancel it
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), toolsListTimeout)
+	go func() {
+		defer cancel()
+		r.tools, r.err = c.list(ctx)
+		if r.err != nil {
+			slog.ErrorContext(ctx, "error listing MCP tools", "error", r.err)
+		}
+
+		c.mu.Lock()
+		if r.err != nil {
+			c.failedAt = time.Now()
+			c.stale.Store(true)
+		} else {
+			c.tools, c.loaded = r.tools, true
+			c.fetchedAt, c.failedAt = time.Now(), time.Time{}
+		}
+		c.refresh = nil
+		c.mu.Unlock()
+		close(r.done)
+	}()
+	return r
+}
+
+func (c *ToolCache) list(ctx context.Context) ([]dto.Tool, error) {
+	mcpTools, err := c.mcpClient.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make([]dto.Tool, 0, len(mcpTools))
+	for _, t := range mcpTools {
+		schema, err := validateInputSchema(t.InputSchema)
+		if err != nil {
+			slog.WarnContext(ctx, "skipping MCP tool with an invalid input schema", "tool", t.Name, "error", err)
+			continue
+		}
+
+		tools = append(tools, dto.Tool{
+			Type: "function",
+			Function: dto.ToolFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  schema,
+			},
+		})
+	}
+
+	slog.InfoContext(ctx, "discovered MCP tools", "tools", len(tools))
+	return tools, nil
+}
+
+// validateInputSchema checks the parts of a tool input schema the models rely on and
+// returns it normalized to an object schema
+func validateInputSchema(schema mcp.ToolInputSchema) (mcp.ToolInputSchema, error) {
+	switch schema.Type {
+	case "":
+		schema.Type = "object"
+	case "object":
+	default:
+		return schema, fmt.Errorf("type must be \"object\", got %q", schema.Type)
+	}
+
+	for name, prop := range schema.Properties {
+		p, ok := prop.(map[string]any)
+		if !ok {
+			return schema, fmt.Errorf("property %q is not an object", name)
+		}
+		if t, ok := p["type"]; ok && !validSchemaType(t) {
+			return schema, fmt.Errorf("property %q has an invalid type %v", name, t)
+		}
+	}
+
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			return schema, fmt.Errorf("required property %q is not defined", name)
+		}
+	}
+
+	if _, err := json.Marshal(schema); err != nil {
+		return schema, err
+	}
+	return schema, nil
+}
+
+func validSchemaType(t any) bool {
+	switch v := t.(type) {
+	case string:
+		return slices.Contains(jsonSchemaTypes, v)
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); !ok || !slices.Contains(jsonSchemaTypes, s) {
+				return false
+			}
+		}
+		return len(v) > 0
+	default:
+		return false
+	}
+}
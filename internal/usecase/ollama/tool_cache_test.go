@@ -0,0 +1,88 @@
+package ollama
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+)
+
+// notifyingClient reports a tool list change while answering every tools/list, on the
+// same goroutine, like the stdio transport does when the notification arrives first
+type notifyingClient struct {
+	mcpclient.MCPClient
+	onChanged func()
+	lists     atomic.Int32
+	// release, when set, holds every list after the first one until it is closed
+	release chan struct{}
+}
+
+func (c *notifyingClient) OnToolsChanged(fn func()) { c.onChanged = fn }
+
+func (c *notifyingClient) ListTools(ctx context.Context) ([]mcp.Tool, error) {
+	n := c.lists.Add(1)
+	c.onChanged()
+	if n > 1 && c.release != nil {
+		<-c.release
+	}
+	return []mcp.Tool{mcp.NewTool(fmt.Sprintf("v%d", n))}, nil
+}
+
+func TestToolCacheListChangedDuringRefresh(t *testing.T) {
+	client := &notifyingClient{release: make(chan struct{})}
+	cache := NewToolCache(client, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if got := toolNames(cache.Tools(ctx)); len(got) != 1 || got[0] != "v1" {
+		t.Fatalf("got %v, want [v1]", got)
+	}
+
+	// The change reported during the first list makes it stale; the old list is served
+	// while the next one is slow
+	if got := toolNames(cache.Tools(ctx)); len(got) != 1 || got[0] != "v1" {
+		t.Fatalf("got %v while refreshing, want [v1]", got)
+	}
+	close(client.release)
+
+	for {
+		if got := toolNames(cache.Tools(ctx)); len(got) == 1 && got[0] != "v1" {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatal("the refreshed list was never served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestToolCacheRefreshSharesRequestInFlight(t *testing.T) {
+	client := &notifyingClient{release: make(chan struct{})}
+	cache := NewToolCache(client, 0)
+	ctx := context.Background()
+	cache.Tools(ctx)
+
+	results := make(chan []string, 2)
+	for range 2 {
+		go func() {
+			tools, _ := cache.Refresh(ctx)
+			results <- toolNames(tools)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(client.release)
+
+	first, second := <-results, <-results
+	if len(first) != 1 || len(second) != 1 || first[0] != second[0] {
+		t.Errorf("got %v and %v, want the same list", first, second)
+	}
+	if n := client.lists.Load(); n != 2 {
+		t.Errorf("the server was listed %d times, want 2", n)
+	}
+}
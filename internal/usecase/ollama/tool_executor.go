@@ -4,11 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/metalpoch/local-synapse/internal/dto"
 	mcpclient "github.com/metalpoch/local-synapse/internal/infrastructure/mcp_client"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+	"github.com/metalpoch/local-synapse/internal/pkg/tracing"
 )
 
 // ToolExecutor handles execution of MCP tool calls
@@ -16,58 +24,186 @@ type ToolExecutor struct {
 	mcpClient mcpclient.MCPClient
 }
 
+// ToolCallResult pairs a tool call with the chat message produced by executing it
+type ToolCallResult struct {
+	Call    dto.ToolCall
+	Message dto.OllamaChatMessage
+	IsError bool
+}
+
 // NewToolExecutor creates a new tool executor
 func NewToolExecutor(mcpClient mcpclient.MCPClient) *ToolExecutor {
 	return &ToolExecutor{mcpClient: mcpClient}
 }
 
-// ExecuteToolCalls executes all tool calls and returns messages to append to chat history
-func (e *ToolExecutor) ExecuteToolCalls(ctx context.Context, toolCalls []dto.ToolCall) ([]dto.OllamaChatMessage, error) {
+// AssignToolCallIDs fills in missing call IDs so every tool message can be matched
+// with the call that produced it. The IDs include the round, keeping them unique
+// across the rounds of a generation. The calls are numbered in order unless the
+// model already numbered them.
+func AssignToolCallIDs(round int, toolCalls []dto.ToolCall) {
+	numbered := slices.ContainsFunc(toolCalls, func(tc dto.ToolCall) bool { return tc.Function.Index != 0 })
+	for i := range toolCalls {
+		if !numbered {
+			toolCalls[i].Function.Index = i
+		}
+		if toolCalls[i].ID == "" {
+			toolCalls[i].ID = fmt.Sprintf("call_%d_%d", round, i)
+		}
+	}
+}
+
+// ExecuteToolCalls executes all tool calls and returns one result per call, in the same order.
+// Calls to tools that were not offered to the model are answered with an error instead.
+func (e *ToolExecutor) ExecuteToolCalls(ctx context.Context, toolCalls []dto.ToolCall, offered []dto.Tool) ([]ToolCallResult, error) {
 	if e.mcpClient == nil {
 		return nil, fmt.Errorf("MCP client not available")
 	}
 
-	var messages []dto.OllamaChatMessage
+	var results []ToolCallResult
 
 	for _, tc := range toolCalls {
-		log.Printf("[MCP] Executing tool: %s", tc.Function.Name)
+		// Stop at the first call that starts after the generation was cancelled
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		results = append(results, e.executeToolCall(ctx, tc, offered))
+	}
+
+	return results, nil
+}
+
+// executeToolCall runs a single call in its own span, from validation to the MCP call
+func (e *ToolExecutor) executeToolCall(ctx context.Context, tc dto.ToolCall, offered []dto.Tool) ToolCallResult {
+	ctx, span := tracing.Tracer().Start(ctx, "execute_tool "+tc.Function.Name, trace.WithAttributes(
+		semconv.GenAIOperationNameExecuteTool,
+		semconv.GenAIToolName(tc.Function.Name),
+		semconv.GenAIToolCallID(tc.ID),
+	))
+	defer span.End()
+
+	ctx = logging.With(ctx, "tool", tc.Function.Name, "call_id", tc.ID)
+	slog.InfoContext(ctx, "executing tool", "arguments", logging.Redact(ctx, formatArguments(tc.Function.Arguments)))
+
+	message := dto.OllamaChatMessage{
+		Role:       "tool",
+		ToolName:   tc.Function.Name,
+		ToolCallID: tc.ID,
+	}
+	fail := func(reason string) ToolCallResult {
+		span.SetStatus(codes.Error, reason)
+		return ToolCallResult{Call: tc, Message: message, IsError: true}
+	}
 
-		result, err := e.mcpClient.CallTool(ctx, tc.Function.Name, tc.Function.Arguments)
-		content := ""
+	i := slices.IndexFunc(offered, func(t dto.Tool) bool { return t.Function.Name == tc.Function.Name })
+	if i < 0 {
+		slog.WarnContext(ctx, "rejected tool call: not offered")
+		message.Content = fmt.Sprintf("Error: tool %q is not available in this conversation", tc.Function.Name)
+		return fail("tool not offered")
+	}
 
-		if err != nil {
-			log.Printf("[MCP] Tool execution failed: %v", err)
-			content = fmt.Sprintf("Error executing tool: %v", err)
-		} else {
-			log.Printf("[MCP] Tool execution successful")
-			content = e.formatToolResult(result)
+	// Check the arguments before calling so the model gets a precise error to fix them
+	args := tc.Function.Arguments
+	if schema, ok := offered[i].Function.Parameters.(mcp.ToolInputSchema); ok {
+		var problems []ArgumentProblem
+		args, problems = ValidateArguments(schema, args)
+		if len(problems) > 0 {
+			slog.WarnContext(ctx, "rejected tool call: invalid arguments", "problems", len(problems))
+			message.Content = invalidArgumentsMessage(tc.Function.Name, problems)
+			return fail("invalid arguments")
 		}
+	}
 
-		// Append tool result message
-		messages = append(messages, dto.OllamaChatMessage{
-			Role:    "tool",
-			Content: content,
-		})
+	result, err := e.mcpClient.CallTool(ctx, tc.Function.Name, args)
+	if err != nil {
+		slog.ErrorContext(ctx, "tool execution failed", "error", err)
+		span.RecordError(err)
+		message.Content = fmt.Sprintf("Error executing tool: %v", err)
+		return fail(err.Error())
 	}
 
-	return messages, nil
+	e.formatToolResult(result, &message)
+	if result.IsError {
+		slog.WarnContext(ctx, "tool reported an error")
+		message.Content = "Error: " + message.Content
+		return fail("tool reported an error")
+	}
+
+	slog.InfoContext(ctx, "tool execution successful")
+	return ToolCallResult{Call: tc, Message: message}
 }
 
-// formatToolResult converts MCP result to string format
-func (e *ToolExecutor) formatToolResult(result *mcp.CallToolResult) string {
-	if result == nil || len(result.Content) == 0 {
-		return ""
+// DeniedToolCallResult answers a tool call the user did not approve
+func DeniedToolCallResult(ctx context.Context, tc dto.ToolCall) ToolCallResult {
+	slog.InfoContext(ctx, "tool call denied by the user", "tool", tc.Function.Name, "call_id", tc.ID)
+	return ToolCallResult{
+		Call: tc,
+		Message: dto.OllamaChatMessage{
+			Role:       "tool",
+			ToolName:   tc.Function.Name,
+			ToolCallID: tc.ID,
+			Content:    fmt.Sprintf("Error: the user denied the call to tool %q", tc.Function.Name),
+		},
+		IsError: true,
+	}
+}
+
+// formatToolResult converts an MCP result into the tool message content,
+// keeping structured data as JSON and forwarding images to the model
+func (e *ToolExecutor) formatToolResult(result *mcp.CallToolResult, message *dto.OllamaChatMessage) {
+	if result == nil {
+		return
+	}
+
+	var parts []string
+
+	// Structured content is the canonical form of the result when the tool provides it
+	if result.StructuredContent != nil {
+		if b, err := json.Marshal(result.StructuredContent); err == nil {
+			parts = append(parts, string(b))
+		}
 	}
 
-	var content string
 	for _, c := range result.Content {
-		if tc, ok := c.(mcp.TextContent); ok {
-			content += tc.Text + " "
-		} else {
+		switch content := c.(type) {
+		case mcp.TextContent:
+			if result.StructuredContent == nil {
+				parts = append(parts, content.Text)
+			}
+		case mcp.ImageContent:
+			message.Images = append(message.Images, content.Data)
+			parts = append(parts, fmt.Sprintf("[image %d attached (%s)]", len(message.Images), content.MIMEType))
+		case mcp.AudioContent:
+			parts = append(parts, fmt.Sprintf("[audio content (%s) omitted]", content.MIMEType))
+		case mcp.ResourceLink:
+			parts = append(parts, fmt.Sprintf("[resource link: %s <%s>]", content.Name, content.URI))
+		case mcp.EmbeddedResource:
+			parts = append(parts, formatEmbeddedResource(content.Resource))
+		default:
 			b, _ := json.Marshal(c)
-			content += string(b) + " "
+			parts = append(parts, string(b))
 		}
 	}
 
-	return content
+	message.Content = strings.Join(parts, "\n")
+}
+
+func formatEmbeddedResource(resource mcp.ResourceContents) string {
+	switch r := resource.(type) {
+	case mcp.TextResourceContents:
+		return fmt.Sprintf("Resource %s:\n%s", r.URI, r.Text)
+	case mcp.BlobResourceContents:
+		return fmt.Sprintf("[binary resource %s (%s), %d bytes base64]", r.URI, r.MIMEType, len(r.Blob))
+	default:
+		b, _ := json.Marshal(resource)
+		return string(b)
+	}
+}
+
+// formatArguments renders tool arguments for the logs
+func formatArguments(args dto.ComponentArguments) string {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Sprint(args)
+	}
+	return string(data)
 }
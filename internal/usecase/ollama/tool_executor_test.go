@@ -0,0 +1,188 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	"github.com/metalpoch/local-synapse/internal/pkg/logging"
+	"github.com/metalpoch/local-synapse/internal/testsupport"
+)
+
+func newTestExecutor(t *testing.T) (*ToolExecutor, []dto.Tool) {
+	t.Helper()
+	client := testsupport.NewMCPClient(t, testsupport.NewMCPServer())
+	tools := NewToolCache(client, 0).Tools(context.Background())
+	if len(tools) == 0 {
+		t.Fatal("no tools listed by the test MCP server")
+	}
+	return NewToolExecutor(client), tools
+}
+
+func TestExecuteToolCalls(t *testing.T) {
+	executor, offered := newTestExecutor(t)
+
+	calls := []dto.ToolCall{
+		testsupport.ToolCall("echo", map[string]any{"text": "hi"}),
+		testsupport.ToolCall("add", map[string]any{"a": 2, "b": 3}),
+	}
+	AssignToolCallIDs(0, calls)
+
+	results, err := executor.ExecuteToolCalls(context.Background(), calls, offered)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	if r := results[0]; r.IsError || r.Message.Content != "hi" || r.Message.Role != "tool" || r.Message.ToolCallID != "call_0_0" {
+		t.Errorf("echo: got %+v", r)
+	}
+	if r := results[1]; r.IsError || r.Message.Content != "5" || r.Message.ToolName != "add" {
+		t.Errorf("add: got %+v", r)
+	}
+}
+
+func TestAssignToolCallIDs(t *testing.T) {
+	calls := []dto.ToolCall{testsupport.ToolCall("echo", nil), testsupport.ToolCall("add", nil)}
+	AssignToolCallIDs(1, calls)
+	if calls[0].ID != "call_1_0" || calls[1].ID != "call_1_1" || calls[1].Function.Index != 1 {
+		t.Errorf("got %+v", calls)
+	}
+
+	// IDs and numbering sent by the model are kept
+	calls = []dto.ToolCall{testsupport.ToolCall("echo", nil), testsupport.ToolCall("add", nil)}
+	calls[0].ID = "model-id"
+	calls[0].Function.Index, calls[1].Function.Index = 3, 4
+	AssignToolCallIDs(0, calls)
+	if calls[0].ID != "model-id" || calls[0].Function.Index != 3 || calls[1].ID != "call_0_1" || calls[1].Function.Index != 4 {
+		t.Errorf("got %+v", calls)
+	}
+}
+
+func TestExecuteToolCallsSendsRequestID(t *testing.T) {
+	executor, offered := newTestExecutor(t)
+
+	ctx := logging.WithRequestID(context.Background(), "req-42")
+	results, err := executor.ExecuteToolCalls(ctx, []dto.ToolCall{testsupport.ToolCall("request_id", nil)}, offered)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls: %v", err)
+	}
+	if r := results[0]; r.IsError || r.Message.Content != "req-42" {
+		t.Errorf("the tool did not receive the request ID: %+v", r)
+	}
+}
+
+func TestExecuteToolCallsRecordsSpans(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	executor, offered := newTestExecutor(t)
+	calls := []dto.ToolCall{testsupport.ToolCall("fail", nil)}
+	if _, err := executor.ExecuteToolCalls(context.Background(), calls, offered); err != nil {
+		t.Fatalf("ExecuteToolCalls: %v", err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	execute, call := spans["execute_tool fail"], spans["tools/call fail"]
+	if execute == nil || call == nil {
+		t.Fatalf("missing spans, got %v", spans)
+	}
+	if call.Parent().SpanID() != execute.SpanContext().SpanID() {
+		t.Error("the MCP call span is not a child of the tool execution span")
+	}
+	if execute.Status().Code != codes.Error || call.Status().Code != codes.Error {
+		t.Errorf("the failed tool is not marked as an error: %v, %v", execute.Status(), call.Status())
+	}
+}
+
+func TestExecuteToolCallsCoercesArguments(t *testing.T) {
+	executor, offered := newTestExecutor(t)
+
+	calls := []dto.ToolCall{testsupport.ToolCall("add", map[string]any{"a": "1.5", "b": 2})}
+	results, err := executor.ExecuteToolCalls(context.Background(), calls, offered)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls: %v", err)
+	}
+	if r := results[0]; r.IsError || r.Message.Content != "3.5" {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestExecuteToolCallsRejectsInvalidArguments(t *testing.T) {
+	executor, offered := newTestExecutor(t)
+
+	calls := []dto.ToolCall{testsupport.ToolCall("add", map[string]any{"a": "two"})}
+	results, err := executor.ExecuteToolCalls(context.Background(), calls, offered)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls: %v", err)
+	}
+
+	r := results[0]
+	if !r.IsError {
+		t.Fatalf("expected an error result, got %+v", r)
+	}
+
+	var body struct {
+		Error    string           `json:"error"`
+		Tool     string           `json:"tool"`
+		Problems []map[string]any `json:"problems"`
+	}
+	if err := json.Unmarshal([]byte(r.Message.Content), &body); err != nil {
+		t.Fatalf("error content is not JSON: %v\n%s", err, r.Message.Content)
+	}
+	if body.Error != "invalid_arguments" || body.Tool != "add" || len(body.Problems) != 2 {
+		t.Errorf("got %+v", body)
+	}
+}
+
+func TestExecuteToolCallsRejectsToolsNotOffered(t *testing.T) {
+	executor, offered := newTestExecutor(t)
+
+	var withoutEcho []dto.Tool
+	for _, tool := range offered {
+		if tool.Function.Name != "echo" {
+			withoutEcho = append(withoutEcho, tool)
+		}
+	}
+
+	calls := []dto.ToolCall{testsupport.ToolCall("echo", map[string]any{"text": "hi"})}
+	results, err := executor.ExecuteToolCalls(context.Background(), calls, withoutEcho)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls: %v", err)
+	}
+	if r := results[0]; !r.IsError || !strings.Contains(r.Message.Content, "not available") {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestExecuteToolCallsToolError(t *testing.T) {
+	executor, offered := newTestExecutor(t)
+
+	results, err := executor.ExecuteToolCalls(context.Background(), []dto.ToolCall{testsupport.ToolCall("fail", nil)}, offered)
+	if err != nil {
+		t.Fatalf("ExecuteToolCalls: %v", err)
+	}
+	if r := results[0]; !r.IsError || r.Message.Content != "Error: something went wrong" {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestExecuteToolCallsWithoutMCP(t *testing.T) {
+	if _, err := NewToolExecutor(nil).ExecuteToolCalls(context.Background(), nil, nil); err == nil {
+		t.Error("expected an error without an MCP client")
+	}
+}
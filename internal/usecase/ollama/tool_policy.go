@@ -0,0 +1,72 @@
+package ollama
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+const (
+	// AnonymousRole is the role used for tool policies when a request carries no token
+	AnonymousRole = "anonymous"
+	// DefaultPolicyRole names the policy applied to roles without a policy of their own
+	DefaultPolicyRole = "default"
+)
+
+// selectTools returns the tools to offer for a chat request: the ones the client asked
+// for, minus the ones it excluded, restricted by the policies of the caller's role and user.
+// Once any policy is configured, a role without a policy, AnonymousRole included, follows
+// DefaultPolicyRole, or gets no tools when there is none.
+func selectTools(ctx context.Context, available []dto.Tool, chat dto.ChatRequest, policies dto.ToolPolicies) []dto.Tool {
+	role, user := AnonymousRole, ""
+	if !chat.Caller.Anonymous() {
+		role, user = chat.Caller.Role, chat.Caller.User
+	}
+
+	// An explicit empty list means no tools at all
+	if chat.Tools != nil && len(chat.Tools) == 0 {
+		return nil
+	}
+
+	rules := []dto.ToolPolicy{{Allow: chat.Tools, Deny: chat.ExcludeTools}}
+	p, ok := policies.Roles[role]
+	if !ok {
+		p, ok = policies.Roles[DefaultPolicyRole]
+	}
+	switch {
+	case ok:
+		rules = append(rules, p)
+	case len(policies.Roles) > 0 || len(policies.Users) > 0:
+		slog.DebugContext(ctx, "no tools for a role without a policy", "role", role)
+		return nil
+	}
+	if p, ok := policies.Users[user]; ok && user != "" {
+		rules = append(rules, p)
+	}
+
+	var selected []dto.Tool
+	for _, t := range available {
+		if allowedBy(rules, t.Function.Name) {
+			selected = append(selected, t)
+		}
+	}
+
+	if len(selected) != len(available) {
+		slog.DebugContext(ctx, "offering a subset of the tools", "offered", len(selected), "available", len(available), "role", role)
+	}
+	return selected
+}
+
+func allowedBy(rules []dto.ToolPolicy, name string) bool {
+	for _, r := range rules {
+		if len(r.Allow) > 0 && !slices.Contains(r.Allow, name) {
+			return false
+		}
+		if slices.Contains(r.Deny, name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package ollama
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+)
+
+func toolNames(tools []dto.Tool) []string {
+	var names []string
+	for _, t := range tools {
+		names = append(names, t.Function.Name)
+	}
+	return names
+}
+
+func TestSelectToolsAppliesPolicies(t *testing.T) {
+	var available []dto.Tool
+	for _, name := range []string{"echo", "add", "fail"} {
+		var tool dto.Tool
+		tool.Function.Name = name
+		available = append(available, tool)
+	}
+	policies := dto.ToolPolicies{
+		Roles: map[string]dto.ToolPolicy{"user": {Allow: []string{"echo", "add"}}},
+		Users: map[string]dto.ToolPolicy{"ana": {Deny: []string{"add"}}},
+	}
+
+	tests := []struct {
+		name   string
+		chat   dto.ChatRequest
+		policy dto.ToolPolicies
+		want   []string
+	}{
+		{"no policies", dto.ChatRequest{}, dto.ToolPolicies{}, []string{"echo", "add", "fail"}},
+		{"role", dto.ChatRequest{Caller: &dto.Caller{User: "bob", Role: "user"}}, policies, []string{"echo", "add"}},
+		{"role and user", dto.ChatRequest{Caller: &dto.Caller{User: "ana", Role: "user"}}, policies, []string{"echo"}},
+		{"client exclusion", dto.ChatRequest{Caller: &dto.Caller{User: "bob", Role: "user"}, ExcludeTools: []string{"echo"}}, policies, []string{"add"}},
+		{"anonymous without a policy", dto.ChatRequest{}, policies, nil},
+		{"unknown role", dto.ChatRequest{Caller: &dto.Caller{User: "eve", Role: "guest"}}, policies, nil},
+		{"unknown role with a default policy", dto.ChatRequest{Caller: &dto.Caller{User: "eve", Role: "guest"}}, dto.ToolPolicies{
+			Roles: map[string]dto.ToolPolicy{DefaultPolicyRole: {Deny: []string{"fail"}}},
+		}, []string{"echo", "add"}},
+		{"anonymous with a default policy", dto.ChatRequest{}, dto.ToolPolicies{
+			Roles: map[string]dto.ToolPolicy{DefaultPolicyRole: {Allow: []string{"echo"}}},
+		}, []string{"echo"}},
+		{"anonymous with a policy", dto.ChatRequest{}, dto.ToolPolicies{
+			Roles: map[string]dto.ToolPolicy{AnonymousRole: {Allow: []string{"fail"}}},
+			Users: policies.Users,
+		}, []string{"fail"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toolNames(selectTools(context.Background(), available, tt.chat, tt.policy)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package prompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/metalpoch/local-synapse/internal/dto"
+	promptstore "github.com/metalpoch/local-synapse/internal/infrastructure/prompt_store"
+)
+
+var (
+	ErrInvalidPrompt   = errors.New("invalid prompt")
+	ErrMissingArgument = errors.New("missing prompt argument")
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// PromptUsecase manages the prompt library and renders its templates
+type PromptUsecase struct {
+	store *promptstore.SQLiteStore
+}
+
+// NewPromptUsecase creates a new prompt usecase
+func NewPromptUsecase(store *promptstore.SQLiteStore) *PromptUsecase {
+	return &PromptUsecase{store: store}
+}
+
+func (uc *PromptUsecase) List(ctx context.Context) ([]dto.PromptTemplate, error) {
+	return uc.store.List(ctx)
+}
+
+func (uc *PromptUsecase) Get(ctx context.Context, name string) (*dto.PromptTemplate, error) {
+	return uc.store.Get(ctx, name)
+}
+
+func (uc *PromptUsecase) Create(ctx context.Context, p dto.PromptTemplate) (*dto.PromptTemplate, error) {
+	if err := validate(p); err != nil {
+		return nil, err
+	}
+	return uc.store.Create(ctx, p)
+}
+
+func (uc *PromptUsecase) Update(ctx context.Context, p dto.PromptTemplate) (*dto.PromptTemplate, error) {
+	if err := validate(p); err != nil {
+		return nil, err
+	}
+	return uc.store.Update(ctx, p)
+}
+
+func (uc *PromptUsecase) Delete(ctx context.Context, name string) error {
+	return uc.store.Delete(ctx, name)
+}
+
+// Render loads the named prompt and executes its template. Date, Time and HostName
+// are filled in when vars leaves them empty.
+func (uc *PromptUsecase) Render(ctx context.Context, name string, vars dto.PromptVariables) (string, error) {
+	p, err := uc.store.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return Render(*p, vars)
+}
+
+// Render executes a prompt template with the given variables
+func Render(p dto.PromptTemplate, vars dto.PromptVariables) (string, error) {
+	for _, arg := range p.Arguments {
+		if arg.Required && vars.Args[arg.Name] == "" {
+			return "", fmt.Errorf("%w: %s", ErrMissingArgument, arg.Name)
+		}
+	}
+
+	now := time.Now()
+	if vars.Date == "" {
+		vars.Date = now.Format("2006-01-02")
+	}
+	if vars.Time == "" {
+		vars.Time = now.Format("15:04")
+	}
+	if vars.HostName == "" {
+		vars.HostName, _ = os.Hostname()
+	}
+	if vars.Args == nil {
+		vars.Args = map[string]string{}
+	}
+
+	tmpl, err := parse(p)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", fmt.Errorf("failed to render prompt %q: %w", p.Name, err)
+	}
+
+	return out.String(), nil
+}
+
+func parse(p dto.PromptTemplate) (*template.Template, error) {
+	tmpl, err := template.New(p.Name).Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Option("missingkey=zero").Parse(p.Template)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrompt, err)
+	}
+	return tmpl, nil
+}
+
+func validate(p dto.PromptTemplate) error {
+	if !validName.MatchString(p.Name) {
+		return fmt.Errorf("%w: name must be 1-64 letters, digits, '.', '_' or '-'", ErrInvalidPrompt)
+	}
+	if strings.TrimSpace(p.Template) == "" {
+		return fmt.Errorf("%w: template is empty", ErrInvalidPrompt)
+	}
+	for _, arg := range p.Arguments {
+		if arg.Name == "" {
+			return fmt.Errorf("%w: argument names cannot be empty", ErrInvalidPrompt)
+		}
+	}
+
+	// Catch template errors when the prompt is saved rather than when a chat uses it
+	tmpl, err := parse(p)
+	if err != nil {
+		return err
+	}
+	sample := dto.PromptVariables{Args: map[string]string{}}
+	for _, arg := range p.Arguments {
+		sample.Args[arg.Name] = arg.Name
+	}
+	if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPrompt, err)
+	}
+
+	return nil
+}